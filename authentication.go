@@ -10,6 +10,7 @@ import (
 // Authentication returns a new AuthenticationFunction with the FunctionRegistrar set to the parent
 func (f *FunctionRegistrar) Authentication() *AuthenticationFunction {
 	a := &AuthenticationFunction{reg: f}
+	a.target = a
 	return a
 }
 
@@ -17,6 +18,7 @@ func (f *FunctionRegistrar) Authentication() *AuthenticationFunction {
 // Implements the CloudEventFunction interface
 type AuthenticationFunction struct {
 	cloudDeployer
+	DeployOptions[*AuthenticationFunction]
 	reg *FunctionRegistrar
 	fn  AuthenticationFunc
 }
@@ -38,13 +40,20 @@ type AuthEvent struct {
 	UID string `json:"uid"`
 }
 
+// Named sets the name the function is deployed with, overriding the NamingStrategy of the registrar
+func (a *AuthenticationFunction) Named(name string) *AuthenticationFunction {
+	a.name = name
+	a.reg.names = nil
+	return a
+}
+
 // Create registers the specified function to the UserCreated event for the Firebase Authentication CloudEvent
 //providers/firebase.auth/eventTypes/user.create
 func (a *AuthenticationFunction) Create(fn AuthenticationFunc) *AuthenticationFunction {
 	a.fn = fn
 
 	a.event = AuthenticationUserCreateEvent
-	a.reg.events[a.Name()] = a
+	a.reg.addEvent("", a)
 	return a
 }
 
@@ -54,7 +63,7 @@ func (a *AuthenticationFunction) Delete(fn AuthenticationFunc) *AuthenticationFu
 	a.fn = fn
 
 	a.event = AuthenticationUserDeleteEvent
-	a.reg.events[a.Name()] = a
+	a.reg.addEvent("", a)
 	return a
 }
 
@@ -62,25 +71,27 @@ func (a *AuthenticationFunction) Delete(fn AuthenticationFunc) *AuthenticationFu
 
 // HandleCloudEvent handles the Firebase Authentication CloudEvent and calls the registered AuthenticationFunction
 func (a *AuthenticationFunction) HandleCloudEvent(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	if a.fn == nil {
+		return Debug.Errf("no AuthFunc registered for [%s]: %w", md.EventType, ErrNilHandler)
+	}
+
 	event := &AuthEvent{}
 	err := dec.Decode(&event)
 	if err != nil {
 		return Debug.Errf("failed to decode AuthEvent [%s]: %s: %s", md.EventType, err, string(dec.data))
 	}
 
-	if a.fn != nil {
-		err = a.fn(ctx, *event)
-		if err != nil {
-			return Debug.Errf("registered AuthFunc failed [%s]: %s: AuthFunc %+v", md.EventType, err, a)
-		}
+	err = a.fn(ctx, *event)
+	if err != nil {
+		return Debug.Errf("registered AuthFunc failed [%s]: %s: AuthFunc %+v", md.EventType, err, a)
 	}
 
 	return nil
 }
 
-// Name returns the name of the function: "auth.user.{create,delete}"
+// Name returns the name of the function: "auth-user-create", see FunctionRegistrar.WithNaming
 func (a *AuthenticationFunction) Name() string {
-	return a.event.String()
+	return a.reg.functionName(a)
 }
 
 // Resource returns the resource of the function: "providers/firebase.auth/eventTypes/user.{create,delete}"
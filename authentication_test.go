@@ -40,7 +40,7 @@ func TestAuthentication(t *testing.T) {
 
 	t.Run("Register Create", func(t *testing.T) {
 		auth := reg.Authentication().Create(testAuthFunc)
-		assert.Same(t, auth, reg.events[auth.Name()], "Authentication function should be registered")
+		assert.Same(t, auth, reg.events[eventKey(auth.Event(), "")], "Authentication function should be registered")
 		assert.NotNil(t, auth.fn, "Authentication function should be equal not nil")
 
 		t.Log("Authentication Function registered for UserCreateEvent")
@@ -48,7 +48,7 @@ func TestAuthentication(t *testing.T) {
 
 	t.Run("Register Delete", func(t *testing.T) {
 		auth := reg.Authentication().Delete(testAuthFunc)
-		assert.Same(t, auth, reg.events[auth.Name()], "Authentication function should be registered")
+		assert.Same(t, auth, reg.events[eventKey(auth.Event(), "")], "Authentication function should be registered")
 		assert.NotNil(t, auth.fn, "Authentication function should be equal not nil")
 
 		t.Log("Authentication Function registered for UserDeleteEvent")
@@ -0,0 +1,236 @@
+package register
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// CloudEvent is a CloudEvents v1.0 event as delivered to 2nd gen Cloud Functions by Eventarc
+type CloudEvent struct {
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	SpecVersion     string    `json:"specversion"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time,omitempty"`
+	DataContentType string    `json:"datacontenttype,omitempty"`
+	Data            []byte    `json:"-"`
+}
+
+// UnmarshalJSON decodes the structured content mode of a CloudEvent
+// data is kept as is for JSON content, otherwise data_base64 or the string value of data is used
+func (e *CloudEvent) UnmarshalJSON(b []byte) error {
+	type cloudEvent CloudEvent
+	var raw struct {
+		cloudEvent
+		Data       json.RawMessage `json:"data"`
+		DataBase64 string          `json:"data_base64"`
+	}
+
+	err := json.Unmarshal(b, &raw)
+	if err != nil {
+		return err
+	}
+
+	*e = CloudEvent(raw.cloudEvent)
+
+	switch {
+	case raw.DataBase64 != "":
+		e.Data, err = base64.StdEncoding.DecodeString(raw.DataBase64)
+		if err != nil {
+			return fmt.Errorf("failed to decode data_base64: %w", err)
+		}
+	case len(raw.Data) > 0 && raw.Data[0] == '"' && !e.isJSON():
+		var s string
+		if err = json.Unmarshal(raw.Data, &s); err != nil {
+			return err
+		}
+		e.Data = []byte(s)
+	default:
+		e.Data = raw.Data
+	}
+
+	return nil
+}
+
+func (e *CloudEvent) isJSON() bool {
+	ct := strings.ToLower(e.DataContentType)
+	return ct == "" || strings.HasPrefix(ct, "application/json") || strings.HasSuffix(strings.SplitN(ct, ";", 2)[0], "+json")
+}
+
+// The 2nd gen CloudEvent types mapped to the 1st gen event types
+var cloudEventTypes = map[string]EventType{
+	"google.cloud.firestore.document.v1.created": FirestoreDocumentCreateEvent.Type(),
+	"google.cloud.firestore.document.v1.updated": FirestoreDocumentUpdateEvent.Type(),
+	"google.cloud.firestore.document.v1.deleted": FirestoreDocumentDeleteEvent.Type(),
+	"google.cloud.firestore.document.v1.written": FirestoreDocumentWriteEvent.Type(),
+
+	"google.firebase.database.ref.v1.created": RealtimeDBRefCreateEvent.Type(),
+	"google.firebase.database.ref.v1.updated": RealtimeDBRefUpdateEvent.Type(),
+	"google.firebase.database.ref.v1.deleted": RealtimeDBRefDeleteEvent.Type(),
+	"google.firebase.database.ref.v1.written": RealtimeDBRefWriteEvent.Type(),
+
+	"google.cloud.storage.object.v1.finalized":       StorageObjectFinalizeEvent.Type(),
+	"google.cloud.storage.object.v1.deleted":         StorageObjectDeleteEvent.Type(),
+	"google.cloud.storage.object.v1.archived":        StorageObjectArchiveEvent.Type(),
+	"google.cloud.storage.object.v1.metadataUpdated": StorageObjectMetadataUpdateEvent.Type(),
+
+	"google.cloud.pubsub.topic.v1.messagePublished": PubSubPublishEvent.Type(),
+}
+
+// cloudEventType returns the 2nd gen CloudEvent type for the given 1st gen event type
+func cloudEventType(t EventType) string {
+	for k, v := range cloudEventTypes {
+		if v == t {
+			return k
+		}
+	}
+	return ""
+}
+
+// CloudEventEntryPoint is the entrypoint for 2nd gen functions, the same registrations serve both generations.
+// Accepts the binary (ce-* headers) & structured (application/cloudevents+json) HTTP encodings of a CloudEvent
+//
+//	f := register.NewRegister().Gen2(true)
+//	f.Firestore().Collection("users").Document("{uid}").Create(&mydata, myFirestoreFunc)
+//
+// now f.CloudEventEntryPoint can be used as the entrypoint when deploying the function
+func (f *FunctionRegistrar) CloudEventEntryPoint(w http.ResponseWriter, r *http.Request) {
+	e, err := ParseCloudEvent(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = f.DispatchCloudEvent(r.Context(), e)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ParseCloudEvent reads a CloudEvent from a request in either binary or structured content mode
+func ParseCloudEvent(r *http.Request) (CloudEvent, error) {
+	e := CloudEvent{}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return e, Debug.Err("cloudevent: failed to read request body", err)
+	}
+	defer r.Body.Close()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/cloudevents+json") {
+		err = json.Unmarshal(body, &e)
+		if err != nil {
+			return e, Debug.Err("cloudevent: failed to decode structured event", err)
+		}
+		return e, nil
+	}
+
+	if r.Header.Get("ce-specversion") == "" {
+		return e, Debug.Errf("cloudevent: request is not a CloudEvent: missing ce-specversion header")
+	}
+
+	e.ID = r.Header.Get("ce-id")
+	e.Source = r.Header.Get("ce-source")
+	e.SpecVersion = r.Header.Get("ce-specversion")
+	e.Type = r.Header.Get("ce-type")
+	e.Subject = r.Header.Get("ce-subject")
+	e.DataContentType = r.Header.Get("Content-Type")
+	e.Data = body
+
+	if t := r.Header.Get("ce-time"); t != "" {
+		e.Time, err = time.Parse(time.RFC3339, t)
+		if err != nil {
+			return e, Debug.Err("cloudevent: failed to parse ce-time", err)
+		}
+	}
+
+	return e, nil
+}
+
+// DispatchCloudEvent maps the type, source & subject of the CloudEvent onto the registered functions
+// and calls the matching function with the same payload that is delivered to 1st gen functions
+func (f *FunctionRegistrar) DispatchCloudEvent(ctx context.Context, e CloudEvent) error {
+	eventType, ok := cloudEventTypes[e.Type]
+	if !ok {
+		return Debug.Errf("cloudevent: unsupported event type: %s", e.Type)
+	}
+
+	// as with 1st gen events, firestore & realtimeDB resources are set as the RawPath, all others by Name
+	md := &metadata.Metadata{
+		EventID:   e.ID,
+		Timestamp: e.Time,
+		EventType: eventType.String(),
+		Resource:  &metadata.Resource{},
+	}
+
+	// source is in the form "//{service}/{resource}"
+	source := strings.TrimPrefix(e.Source, "//")
+	service := source
+	if i := strings.Index(source, "/"); i >= 0 {
+		service, source = source[:i], source[i+1:]
+	}
+	md.Resource.Service = service
+
+	data := e.Data
+	switch {
+	case FirestoreEventType(eventType).Valid():
+		// source: projects/{project}/databases/{database} subject: documents/{path}
+		md.Resource.RawPath = strings.Join([]string{source, e.Subject}, "/")
+
+		if !e.isJSON() {
+			evt, err := protoDocumentEventData(e.Data)
+			if err != nil {
+				return Debug.Err("cloudevent: failed to decode firestore event", err)
+			}
+			data, err = json.Marshal(evt)
+			if err != nil {
+				return Debug.Err("cloudevent: failed to encode firestore event", err)
+			}
+		}
+
+	case RealtimeDBEventType(eventType).Valid():
+		// source: projects/_/locations/{location}/instances/{instance} subject: refs/{path}
+		parts := strings.Split(source, "/")
+		md.Resource.RawPath = fmt.Sprintf("projects/_/instances/%s/%s", parts[len(parts)-1], e.Subject)
+
+	case StorageEventType(eventType).Valid():
+		// source: projects/_/buckets/{bucket} subject: objects/{path}
+		md.Resource.Name = strings.Join([]string{source, e.Subject}, "/")
+
+	case PubSubEventType(eventType).Valid():
+		// source: projects/{project}/topics/{topic}
+		md.Resource.Name = source
+
+		// the message has the same shape as the payload of 1st gen functions: {"data": "<base64>", "attributes": {...}}
+		var msg struct {
+			Message json.RawMessage `json:"message"`
+		}
+		err := json.Unmarshal(e.Data, &msg)
+		if err != nil {
+			return Debug.Err("cloudevent: failed to decode pubsub message", err)
+		}
+		data = msg.Message
+	}
+
+	return f.EntryPoint(metadata.NewContext(ctx, md), &Decoder{data: data})
+}
+
+// Gen2 sets the functions to deploy as 2nd gen Cloud Functions
+// using the CloudEventEntryPoint & --trigger-event-filters rather than --trigger-event/--trigger-resource
+// Firebase Authentication triggers are not available for 2nd gen and are always deployed as 1st gen functions
+func (f *FunctionRegistrar) Gen2(t bool) *FunctionRegistrar {
+	f.gen2 = t
+	return f
+}
@@ -0,0 +1,306 @@
+package register
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func protoTestValue(num protowire.Number, fn func(b []byte) []byte) []byte {
+	var v []byte
+	v = protowire.AppendTag(v, num, protowire.BytesType)
+	return protowire.AppendBytes(v, fn(nil))
+}
+
+func protoTestField(name string, value []byte) []byte {
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, name)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, value)
+	return entry
+}
+
+// protoTestDocumentEventData builds a DocumentEventData message equivalent to a subset of the firestore fixture
+func protoTestDocumentEventData(name string) []byte {
+	var fields []byte
+
+	var bb []byte
+	bb = protowire.AppendTag(bb, 1, protowire.VarintType)
+	bb = protowire.AppendVarint(bb, 1)
+	fields = protowire.AppendTag(fields, 2, protowire.BytesType)
+	fields = protowire.AppendBytes(fields, protoTestField("BB", bb))
+
+	var n []byte
+	n = protowire.AppendTag(n, 2, protowire.VarintType)
+	n = protowire.AppendVarint(n, 123)
+	fields = protowire.AppendTag(fields, 2, protowire.BytesType)
+	fields = protowire.AppendBytes(fields, protoTestField("NNNNN", n))
+
+	var a []byte
+	a = protowire.AppendTag(a, 17, protowire.BytesType)
+	a = protowire.AppendString(a, "ertert")
+	var b []byte
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, math.Float64bits(6544))
+	ms := protoTestValue(6, func(v []byte) []byte {
+		v = protowire.AppendTag(v, 1, protowire.BytesType)
+		v = protowire.AppendBytes(v, protoTestField("A", a))
+		v = protowire.AppendTag(v, 1, protowire.BytesType)
+		return protowire.AppendBytes(v, protoTestField("B", b))
+	})
+	fields = protowire.AppendTag(fields, 2, protowire.BytesType)
+	fields = protowire.AppendBytes(fields, protoTestField("MS", ms))
+
+	var ts []byte
+	ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 1641167995)
+	ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 897215000)
+
+	var doc []byte
+	doc = protowire.AppendTag(doc, 1, protowire.BytesType)
+	doc = protowire.AppendString(doc, name)
+	doc = append(doc, fields...)
+	doc = protowire.AppendTag(doc, 3, protowire.BytesType)
+	doc = protowire.AppendBytes(doc, ts)
+
+	var mask []byte
+	mask = protowire.AppendTag(mask, 1, protowire.BytesType)
+	mask = protowire.AppendString(mask, "MS.B")
+
+	var evt []byte
+	evt = protowire.AppendTag(evt, 1, protowire.BytesType)
+	evt = protowire.AppendBytes(evt, doc)
+	evt = protowire.AppendTag(evt, 2, protowire.BytesType)
+	evt = protowire.AppendBytes(evt, doc)
+	evt = protowire.AppendTag(evt, 3, protowire.BytesType)
+	evt = protowire.AppendBytes(evt, mask)
+	return evt
+}
+
+func TestCloudEvent(t *testing.T) {
+	reg := NewRegister()
+	called := map[string]int{}
+
+	const docName = "projects/cleanflo-admin/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN"
+
+	testFsFunc := func(ctx context.Context, e FirestoreEvent) error {
+		called["firestore"]++
+		assert.IsType(t, &TestFirestoreI{}, e.Value.Fields, "Value.Fields did not match expected type")
+		if v, ok := e.Value.Fields.(*TestFirestoreI); ok {
+			assert.Equal(t, true, v.BB, "BB should be decoded")
+			assert.Equal(t, float64(123), v.NNNNN, "NNNNN should be decoded")
+			assert.Equal(t, "ertert", v.MS.A, "MS.A should be decoded")
+		}
+		assert.Equal(t, "5914E2YLVWcUDHisQwQN", e.Vars()["uid"], "vars did not contain expected value")
+		return nil
+	}
+	reg.Firestore().Collection("testColl").Document("{uid}").Update(TestFirestoreI{}, testFsFunc)
+
+	testDbFunc := func(ctx context.Context, e RTDBEvent) error {
+		called["rtdb"]++
+		assert.IsType(t, &TestRTDBI{}, e.Data, "Data did not match expected type")
+		assert.Equal(t, "5914E2YLVWcUDHisQwQN", e.Vars()["uid"], "vars did not contain expected value")
+		return nil
+	}
+	reg.RealtimeDB().Ref("testColl/{uid}").Write(TestRTDBI{}, testDbFunc)
+
+	testStorageFunc := func(ctx context.Context, e StorageEvent) error {
+		called["storage"]++
+		assert.Equal(t, "profile/image.jpg", e.Name, "Name should be decoded")
+		return nil
+	}
+	reg.Storage().Bucket("testBucket").Finalize(testStorageFunc)
+
+	testPubSubFunc := func(ctx context.Context, m PubSubMessage) error {
+		called["pubsub"]++
+		assert.IsType(t, &TestPubSubI{}, m.Data, "Data should be of type TestPubSubI")
+		if v, ok := m.Data.(*TestPubSubI); ok {
+			assert.Equal(t, "other@email.com", v.Email, "Email should match")
+		}
+		assert.Equal(t, "5", m.MessageID, "MessageID should be decoded")
+		return nil
+	}
+	reg.PubSub("test-topic").Publish(TestPubSubI{}, testPubSubFunc)
+
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		reg.CloudEventEntryPoint(w, r)
+		return w
+	}
+
+	t.Run("Firestore Structured JSON", func(t *testing.T) {
+		body := fmt.Sprintf(`{
+			"specversion": "1.0",
+			"id": "1",
+			"type": "google.cloud.firestore.document.v1.updated",
+			"source": "//firestore.googleapis.com/projects/cleanflo-admin/databases/(default)",
+			"subject": "documents/testColl/5914E2YLVWcUDHisQwQN",
+			"datacontenttype": "application/json",
+			"data": {"value": {"name": "%s", "fields": {"BB": {"booleanValue": true}, "NNNNN": {"integerValue": "123"}, "MS": {"mapValue": {"fields": {"A": {"stringValue": "ertert"}}}}}}, "oldValue": {"fields": {}}, "updateMask": {"fieldPaths": ["MS.A"]}}
+		}`, docName)
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/cloudevents+json")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusOK, w.Code, "response should be ok: %s", w.Body.String())
+	})
+
+	t.Run("Firestore Binary Protobuf", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(protoTestDocumentEventData(docName)))
+		r.Header.Set("Content-Type", "application/protobuf")
+		r.Header.Set("ce-specversion", "1.0")
+		r.Header.Set("ce-id", "2")
+		r.Header.Set("ce-type", "google.cloud.firestore.document.v1.updated")
+		r.Header.Set("ce-source", "//firestore.googleapis.com/projects/cleanflo-admin/databases/(default)")
+		r.Header.Set("ce-subject", "documents/testColl/5914E2YLVWcUDHisQwQN")
+		r.Header.Set("ce-time", "2022-01-03T03:41:22.930655Z")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusOK, w.Code, "response should be ok: %s", w.Body.String())
+	})
+
+	t.Run("Firestore Protobuf Decode", func(t *testing.T) {
+		evt, err := protoDocumentEventData(protoTestDocumentEventData(docName))
+		assert.Nil(t, err, "protobuf should decode")
+
+		value := evt["value"].(map[string]interface{})
+		assert.Equal(t, docName, value["name"], "name should be decoded")
+		assert.Equal(t, "2022-01-02T23:59:55.897215Z", value["createTime"], "createTime should be decoded")
+
+		fields := value["fields"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"booleanValue": true}, fields["BB"], "boolean should be decoded")
+		assert.Equal(t, map[string]interface{}{"integerValue": "123"}, fields["NNNNN"], "integer should be decoded")
+		assert.Equal(t, map[string]interface{}{"mapValue": map[string]interface{}{"fields": map[string]interface{}{
+			"A": map[string]interface{}{"stringValue": "ertert"},
+			"B": map[string]interface{}{"doubleValue": float64(6544)},
+		}}}, fields["MS"], "map should be decoded")
+
+		assert.Equal(t, map[string]interface{}{"fieldPaths": []interface{}{"MS.B"}}, evt["updateMask"], "update mask should be decoded")
+
+		_, err = protoDocumentEventData([]byte{0xff})
+		assert.NotNil(t, err, "invalid protobuf should fail")
+	})
+
+	t.Run("RealtimeDB Structured", func(t *testing.T) {
+		body := `{
+			"specversion": "1.0",
+			"id": "3",
+			"type": "google.firebase.database.ref.v1.written",
+			"source": "//firebasedatabase.googleapis.com/projects/_/locations/us-central1/instances/cleanflo-admin",
+			"subject": "refs/testColl/5914E2YLVWcUDHisQwQN",
+			"datacontenttype": "application/json",
+			"data": {"data": {"NNNNN": 112.45}, "delta": {"NNNNN": 112.46545}}
+		}`
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusOK, w.Code, "response should be ok: %s", w.Body.String())
+	})
+
+	t.Run("Storage Binary", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"kind": "storage#object", "name": "profile/image.jpg", "bucket": "testBucket"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("ce-specversion", "1.0")
+		r.Header.Set("ce-id", "4")
+		r.Header.Set("ce-type", "google.cloud.storage.object.v1.finalized")
+		r.Header.Set("ce-source", "//storage.googleapis.com/projects/_/buckets/testBucket")
+		r.Header.Set("ce-subject", "objects/profile/image.jpg")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusOK, w.Code, "response should be ok: %s", w.Body.String())
+	})
+
+	t.Run("PubSub Structured", func(t *testing.T) {
+		data := base64.StdEncoding.EncodeToString([]byte(`{"email": "other@email.com"}`))
+		body := fmt.Sprintf(`{
+			"specversion": "1.0",
+			"id": "5",
+			"type": "google.cloud.pubsub.topic.v1.messagePublished",
+			"source": "//pubsub.googleapis.com/projects/cleanflo-admin/topics/test-topic",
+			"datacontenttype": "application/json",
+			"data": {"message": {"data": "%s", "messageId": "5"}, "subscription": "projects/cleanflo-admin/subscriptions/test"}
+		}`, data)
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/cloudevents+json")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusOK, w.Code, "response should be ok: %s", w.Body.String())
+	})
+
+	t.Run("Called", func(t *testing.T) {
+		assert.Equal(t, map[string]int{"firestore": 2, "rtdb": 1, "storage": 1, "pubsub": 1}, called, "each registered function should be called")
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("ce-specversion", "1.0")
+		r.Header.Set("ce-type", "google.cloud.unknown.v1.event")
+
+		w := serve(r)
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "unsupported event types should fail")
+
+		r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+		r.Header.Set("Content-Type", "application/json")
+
+		w = serve(r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "requests without a CloudEvent should fail")
+	})
+
+	t.Run("Structured Base64", func(t *testing.T) {
+		e := CloudEvent{}
+		err := e.UnmarshalJSON([]byte(`{"specversion": "1.0", "type": "t", "datacontenttype": "application/octet-stream", "data_base64": "aGVsbG8="}`))
+		assert.Nil(t, err, "structured event should decode")
+		assert.Equal(t, []byte("hello"), e.Data, "data_base64 should be decoded")
+
+		err = e.UnmarshalJSON([]byte(`{"specversion": "1.0", "type": "t", "datacontenttype": "text/plain", "data": "hello"}`))
+		assert.Nil(t, err, "structured event should decode")
+		assert.Equal(t, []byte("hello"), e.Data, "string data should be unquoted")
+	})
+}
+
+func TestDeployGen2(t *testing.T) {
+	reg := NewRegister().WithRegistrar("Registrar").WithProjectID("my-project-id").Gen2(true)
+
+	reg.Authentication().Create(nil)
+	reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, nil)
+	reg.PubSub("test-topic").Publish(TestPubSubI{}, nil)
+	reg.RealtimeDB().Ref("messages/{pushId}").Write(TestRTDBI{}, nil)
+	reg.Storage().Bucket("testBucket").Finalize(nil)
+
+	cmd := reg.DeployCloud()
+	fmt.Println(cmd)
+
+	assert.Contains(t, cmd, `--entry-point "Registrar.EntryPoint" --runtime "go116" --verbosity "debug" \
+auth-user-create --trigger-event "providers/firebase.auth/eventTypes/user.create"`, "auth should be deployed as a 1st gen function")
+	assert.Contains(t, cmd, `--entry-point "Registrar.CloudEventEntryPoint" --runtime "go116" --verbosity "debug" --gen2 \
+firestore-doc-create-users-uid --trigger-event-filters "type=google.cloud.firestore.document.v1.created" --trigger-event-filters "database=(default)" --trigger-event-filters-path-pattern "document=users/{uid}"`, "firestore should use event filters")
+	assert.Contains(t, cmd, `--gen2 \
+pubsub-publish-test-topic --trigger-topic "test-topic"`, "pubsub should use trigger topic")
+	assert.Contains(t, cmd, `--gen2 \
+rtdb-ref-write-messages-push-id --trigger-event-filters "type=google.firebase.database.ref.v1.written" --trigger-event-filters "instance=my-project-id" --trigger-event-filters-path-pattern "ref=messages/{pushId}" --trigger-location "us-central1"`, "realtimeDB should use event filters")
+
+	reg.RealtimeDB().Instance("my-project-id-default-rtdb").Location("europe-west1").Ref("rooms/{roomId}").Create(TestRTDBI{}, nil)
+	assert.Contains(t, reg.DeployCloud(), `--trigger-event-filters "instance=my-project-id-default-rtdb" --trigger-event-filters-path-pattern "ref=rooms/{roomId}" --trigger-location "europe-west1"`, "realtimeDB should use the instance & location")
+	assert.Contains(t, reg.DeployTerraform(), `trigger_region = "europe-west1"`, "terraform should use the location")
+	assert.Contains(t, cmd, `--gen2 \
+storage-object-finalize-test-bucket --trigger-event-filters "type=google.cloud.storage.object.v1.finalized" --trigger-event-filters "bucket=testBucket"`, "storage should use event filters")
+
+	assert.Contains(t, reg.DeployHTTP(), "--gen2", "http should be deployed as 2nd gen")
+	assert.Contains(t, reg.Gen2(false).DeployCloud(), `--trigger-resource "projects/_/instances/my-project-id-default-rtdb/refs/rooms/{roomId}"`, "1st gen should use the instance")
+}
@@ -19,6 +19,19 @@ type CloudDeployFunction interface {
 type cloudDeployer struct {
 	resource string
 	event    event
+	name     string // set by Named, overrides the NamingStrategy of the registrar
+	key      string // the key of the function in FunctionRegistrar.events, unique to each trigger
+}
+
+// deployer returns the cloudDeployer embedded in each registered function
+func (c *cloudDeployer) deployer() *cloudDeployer {
+	return c
+}
+
+// registeredFunction is implemented by the functions that are saved in FunctionRegistrar.events
+type registeredFunction interface {
+	CloudDeployFunction
+	deployer() *cloudDeployer
 }
 
 type deployFlags struct {
@@ -26,6 +39,7 @@ type deployFlags struct {
 	entrypoint string
 	runtime    string
 	verbosity  string
+	gen2       bool
 }
 
 type flagKind int
@@ -36,14 +50,17 @@ func (f flagKind) entrypoint() string {
 		return "HttpEntrypoint"
 	case cloudFlags:
 		return "EntryPoint"
+	case cloudEventFlags:
+		return "CloudEventEntryPoint"
 	default:
 		return ""
 	}
 }
 
 const (
-	httpFlags  flagKind = 0
-	cloudFlags flagKind = 1
+	httpFlags       flagKind = 0
+	cloudFlags      flagKind = 1
+	cloudEventFlags flagKind = 2
 )
 
 func (f *FunctionRegistrar) flags(k flagKind) (flag deployFlags) {
@@ -68,6 +85,8 @@ func (f *FunctionRegistrar) flags(k flagKind) (flag deployFlags) {
 		flag.verbosity = WarningVerbosity.String()
 	}
 
+	flag.gen2 = k == cloudEventFlags || (k == httpFlags && f.gen2)
+
 	return flag
 }
 
@@ -88,36 +107,86 @@ func (f deployFlags) String() (s string) {
 		s += fmt.Sprintf(" --verbosity \"%s\"", f.verbosity)
 
 	}
+
+	if f.gen2 {
+		s += " --gen2"
+	}
 	return s
 }
 
+// eventDatabase returns the ID of the Firestore database of the function, "(default)" for functions without a database
+func eventDatabase(fn CloudDeployFunction) string {
+	if fs, ok := fn.(*FirestoreFunction); ok {
+		return fs.DatabaseID()
+	}
+	return defaultDatabase
+}
+
+// eventInstance returns the Realtime Database instance of the function, the project ID for functions without an instance
+func eventInstance(fn CloudDeployFunction, projectID string) string {
+	if db, ok := fn.(*RealtimeDBFunction); ok && db.InstanceID() != "" {
+		return db.InstanceID()
+	}
+	return projectID
+}
+
+// eventLocation returns the region of the Realtime Database instance of the function
+func eventLocation(fn CloudDeployFunction) string {
+	if db, ok := fn.(*RealtimeDBFunction); ok {
+		return db.LocationID()
+	}
+	return defaultRegion
+}
+
 func (f *FunctionRegistrar) DeployCloud() (s string) {
 	flags := f.flags(cloudFlags)
+	gen2Flags := f.flags(cloudEventFlags)
 
 	// walk the functions and register each one
 	cmds := []string{}
-	for name, ev := range f.events {
+	for _, de := range f.deployEvents() {
+		ev, name := de.fn, de.name
+		opts := f.functionOptions(ev)
 		cmd := fmt.Sprintf("gcloud functions deploy %s \\\n", flags.String())
+		if f.gen2 && !AuthEventType(ev.Event()).Valid() {
+			cmd = fmt.Sprintf("gcloud functions deploy %s \\\n", gen2Flags.String())
+		}
+
 		switch ev.Event() {
 		case AuthenticationUserCreateEvent.Type(), AuthenticationUserDeleteEvent.Type():
 			cmd += "%s --trigger-event \"%s\""
-			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String()))
+			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String())+opts.String())
 
 		case FirestoreDocumentCreateEvent.Type(), FirestoreDocumentDeleteEvent.Type(), FirestoreDocumentUpdateEvent.Type(), FirestoreDocumentWriteEvent.Type():
-			cmd += "%s --trigger-event \"%s\" --trigger-resource \"projects/%s/databases/(default)/documents/%s\""
-			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), flags.projectID, ev.Resource()))
+			if f.gen2 {
+				cmd += "%s --trigger-event-filters \"type=%s\" --trigger-event-filters \"database=%s\" --trigger-event-filters-path-pattern \"document=%s\""
+				cmds = append(cmds, fmt.Sprintf(cmd, name, cloudEventType(ev.Event()), eventDatabase(ev), ev.Resource())+opts.String())
+				break
+			}
+			cmd += "%s --trigger-event \"%s\" --trigger-resource \"projects/%s/databases/%s/documents/%s\""
+			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), flags.projectID, eventDatabase(ev), ev.Resource())+opts.String())
 
 		case PubSubPublishEvent.Type():
 			cmd += "%s --trigger-topic \"%s\""
-			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Resource()))
+			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Resource())+opts.String())
 
 		case RealtimeDBRefCreateEvent.Type(), RealtimeDBRefDeleteEvent.Type(), RealtimeDBRefUpdateEvent.Type(), RealtimeDBRefWriteEvent.Type():
+			if f.gen2 {
+				cmd += "%s --trigger-event-filters \"type=%s\" --trigger-event-filters \"instance=%s\" --trigger-event-filters-path-pattern \"ref=%s\" --trigger-location \"%s\""
+				cmds = append(cmds, fmt.Sprintf(cmd, name, cloudEventType(ev.Event()), eventInstance(ev, flags.projectID), ev.Resource(), eventLocation(ev))+opts.String())
+				break
+			}
 			cmd += "%s --trigger-event \"%s\" --trigger-resource \"projects/_/instances/%s/refs/%s\""
-			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), flags.projectID, ev.Resource()))
+			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), eventInstance(ev, flags.projectID), ev.Resource())+opts.String())
 
 		case StorageObjectFinalizeEvent.Type(), StorageObjectArchiveEvent.Type(), StorageObjectDeleteEvent.Type(), StorageObjectMetadataUpdateEvent.Type():
+			if f.gen2 {
+				cmd += "%s --trigger-event-filters \"type=%s\" --trigger-event-filters \"bucket=%s\""
+				cmds = append(cmds, fmt.Sprintf(cmd, name, cloudEventType(ev.Event()), ev.Resource())+opts.String())
+				break
+			}
 			cmd += "%s --trigger-event \"%s\" --trigger-resource \"%s\""
-			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), ev.Resource()))
+			cmds = append(cmds, fmt.Sprintf(cmd, name, ev.Event().String(), ev.Resource())+opts.String())
 		}
 	}
 
@@ -131,16 +200,45 @@ func (f *FunctionRegistrar) DeployHTTP() (s string) {
 
 	// outputs a bash script the can be used to deploy the functions
 
-	auth := ""
+	args := []string{"gcloud functions deploy"}
+	if fl := strings.TrimSpace(flags.String()); fl != "" {
+		args = append(args, fl)
+	}
+	args = append(args, f.registrar, "--trigger-http")
 	if f.httpUnauthenticated {
-		auth = "--allow-unauthenticated"
+		args = append(args, "--allow-unauthenticated")
+	}
+	if opts := strings.TrimSpace(f.httpOptions().String()); opts != "" {
+		args = append(args, opts)
 	}
 
-	s = fmt.Sprintf("gcloud functions deploy %s %s --trigger-http %s", flags.String(), f.registrar, auth)
+	s = strings.Join(args, " ")
 	return s
 }
 
-func (f *FunctionRegistrar) Deploy() (s string) {
+// Deploy outputs a bash script that deploys the cloud event & http functions, see DeployE
+// when Validate fails the script prints the errors to stderr and exits with status 1 instead of deploying
+func (f *FunctionRegistrar) Deploy() string {
+	s, err := f.DeployE()
+	if err != nil {
+		Error.Msgf("refusing to deploy: %s", err)
+		return fmt.Sprintf("echo %s >&2; exit 1", shellQuote(fmt.Sprintf("refusing to deploy: %s", err)))
+	}
+	return s
+}
+
+// shellQuote quotes s as a single argument for bash
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// DeployE outputs a bash script that deploys the cloud event & http functions
+// returns the *ValidationError when Validate fails, DeployCloud & DeployHTTP output the commands without validating
+func (f *FunctionRegistrar) DeployE() (string, error) {
+	if err := f.Validate(); err != nil {
+		return "", err
+	}
+
 	cmd := []string{}
 	if cloud := f.DeployCloud(); cloud != "" {
 		cmd = append(cmd, cloud)
@@ -151,8 +249,7 @@ func (f *FunctionRegistrar) Deploy() (s string) {
 	}
 
 	// outputs a bash script the can be used to deploy the functions
-	s = strings.Join(cmd, " &&  \\\n")
-	return s
+	return strings.Join(cmd, " &&  \\\n"), nil
 }
 
 // VerbosityLevel is for setting the verbosity level for the deploy command
@@ -247,6 +344,12 @@ func (f *FunctionRegistrar) AllowUnauthenticated(t bool) *FunctionRegistrar {
 // PUBSUB
 // gcloud functions deploy FUNCTION_NAME --trigger-topic TOPIC_NAME
 
+// 2ND GEN
+// gcloud functions deploy FUNCTION_NAME --gen2 --trigger-topic TOPIC_NAME
+// gcloud functions deploy FUNCTION_NAME --gen2 --trigger-event-filters "type=google.cloud.storage.object.v1.finalized" --trigger-event-filters "bucket=BUCKET"
+// gcloud functions deploy FUNCTION_NAME --gen2 --trigger-event-filters "type=google.cloud.firestore.document.v1.created" --trigger-event-filters "database=(default)" --trigger-event-filters-path-pattern "document=messages/{pushId}"
+// gcloud functions deploy FUNCTION_NAME --gen2 --trigger-event-filters "type=google.firebase.database.ref.v1.written" --trigger-event-filters "instance=INSTANCE" --trigger-event-filters-path-pattern "ref=messages/{pushId}" --trigger-location REGION
+
 // STORAGE
 // gcloud functions deploy FUNCTION_NAME --trigger-event EVENT --trigger-resource YOUR_TRIGGER_BUCKET_NAME
 
@@ -0,0 +1,443 @@
+package register
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var terraformLabelRegexp = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// defaultRegion is the location of 2nd gen functions without a region, the default region of gcloud functions deploy
+const defaultRegion = "us-central1"
+
+// DeployTerraform outputs a Terraform configuration that declares a google_cloudfunctions_function
+// resource for every registered function, plus a single resource for the http functions.
+// With Gen2 the functions are declared as google_cloudfunctions2_function resources, except for Firebase Authentication triggers.
+// The output is deterministic (resources are sorted by function name) and formatted as `terraform fmt` would.
+//
+// The source archive is expected to be uploaded separately and is referenced through
+// the variables source_archive_bucket & source_archive_object.
+// If no project id was provided with WithProjectID, a project_id variable is declared as well.
+func (f *FunctionRegistrar) DeployTerraform() string {
+	cloud := f.flags(cloudFlags)
+	cloudEvent := f.flags(cloudEventFlags)
+
+	project := hclString(f.projectID)
+	projectRef := hclEscape(f.projectID)
+	if f.projectID == "" {
+		project = "var.project_id"
+		projectRef = "${var.project_id}"
+	}
+
+	blocks := []*hclBlock{
+		hclVariable("source_archive_bucket"),
+		hclVariable("source_archive_object"),
+	}
+	if f.projectID == "" {
+		blocks = append(blocks, hclVariable("project_id"))
+	}
+
+	for _, de := range f.deployEvents() {
+		ev, name := de.fn, de.name
+
+		if f.gen2 && !AuthEventType(ev.Event()).Valid() {
+			trigger := terraformEventTrigger(ev, projectRef)
+			if trigger == nil {
+				continue
+			}
+
+			fn := terraformFunction2(name, project, cloudEvent, f.functionOptions(ev))
+			fn.blocks = append(fn.blocks, trigger)
+			blocks = append(blocks, fn)
+			continue
+		}
+
+		var eventType, resource string
+		switch ev.Event() {
+		case AuthenticationUserCreateEvent.Type(), AuthenticationUserDeleteEvent.Type():
+			eventType = ev.Event().String()
+			resource = fmt.Sprintf(`"projects/%s"`, projectRef)
+
+		case FirestoreDocumentCreateEvent.Type(), FirestoreDocumentDeleteEvent.Type(), FirestoreDocumentUpdateEvent.Type(), FirestoreDocumentWriteEvent.Type():
+			eventType = ev.Event().String()
+			resource = fmt.Sprintf(`"projects/%s/databases/%s/documents/%s"`, projectRef, hclEscape(eventDatabase(ev)), hclEscape(ev.Resource()))
+
+		case PubSubPublishEvent.Type():
+			eventType = ev.Event().String()
+			resource = fmt.Sprintf(`"projects/%s/topics/%s"`, projectRef, hclEscape(ev.Resource()))
+
+		case RealtimeDBRefCreateEvent.Type(), RealtimeDBRefDeleteEvent.Type(), RealtimeDBRefUpdateEvent.Type(), RealtimeDBRefWriteEvent.Type():
+			eventType = ev.Event().String()
+			resource = fmt.Sprintf(`"projects/_/instances/%s/refs/%s"`, terraformInstance(ev, projectRef), hclEscape(ev.Resource()))
+
+		case StorageObjectFinalizeEvent.Type(), StorageObjectArchiveEvent.Type(), StorageObjectDeleteEvent.Type(), StorageObjectMetadataUpdateEvent.Type():
+			eventType = ev.Event().String()
+			resource = hclString(ev.Resource())
+
+		default:
+			continue
+		}
+
+		fn := terraformFunction(name, project, cloud, f.functionOptions(ev))
+		fn.blocks = append(fn.blocks, &hclBlock{
+			header: "event_trigger",
+			groups: [][]hclAttr{{
+				{key: "event_type", value: hclString(eventType)},
+				{key: "resource", value: resource},
+			}},
+		})
+
+		blocks = append(blocks, fn)
+	}
+
+	if len(f.handlers) > 0 {
+		name := f.registrar
+		if name == "" {
+			name = "Registrar"
+		}
+
+		if f.gen2 {
+			// 2nd gen functions without an event_trigger are triggered by http
+			blocks = append(blocks, terraformFunction2(name, project, f.flags(httpFlags), f.httpOptions()))
+		} else {
+			fn := terraformFunction(name, project, f.flags(httpFlags), f.httpOptions())
+			fn.groups = append(fn.groups, []hclAttr{{key: "trigger_http", value: "true"}})
+			blocks = append(blocks, fn)
+		}
+
+		if f.httpUnauthenticated && f.gen2 {
+			// 2nd gen functions are invoked through their Cloud Run service
+			fn := fmt.Sprintf("google_cloudfunctions2_function.%s", terraformLabel(name))
+			blocks = append(blocks, &hclBlock{
+				header: fmt.Sprintf(`resource "google_cloud_run_service_iam_member" %s`, hclString(terraformLabel(name)+"_invoker")),
+				groups: [][]hclAttr{{
+					{key: "project", value: fn + ".project"},
+					{key: "location", value: fn + ".location"},
+					{key: "service", value: fn + ".service_config[0].service"},
+				}, {
+					{key: "role", value: hclString("roles/run.invoker")},
+					{key: "member", value: hclString("allUsers")},
+				}},
+			})
+		} else if f.httpUnauthenticated {
+			blocks = append(blocks, &hclBlock{
+				header: fmt.Sprintf(`resource "google_cloudfunctions_function_iam_member" %s`, hclString(terraformLabel(name)+"_invoker")),
+				groups: [][]hclAttr{{
+					{key: "project", value: fmt.Sprintf("google_cloudfunctions_function.%s.project", terraformLabel(name))},
+					{key: "region", value: fmt.Sprintf("google_cloudfunctions_function.%s.region", terraformLabel(name))},
+					{key: "cloud_function", value: fmt.Sprintf("google_cloudfunctions_function.%s.name", terraformLabel(name))},
+				}, {
+					{key: "role", value: hclString("roles/cloudfunctions.invoker")},
+					{key: "member", value: hclString("allUsers")},
+				}},
+			})
+		}
+	}
+
+	s := &strings.Builder{}
+	for i, b := range blocks {
+		if i > 0 {
+			s.WriteString("\n")
+		}
+		b.render(s, 0)
+	}
+
+	return s.String()
+}
+
+// terraformFunction creates the google_cloudfunctions_function resource block shared by all triggers
+func terraformFunction(name, project string, flags deployFlags, opts deployOptions) *hclBlock {
+	b := &hclBlock{
+		header: fmt.Sprintf(`resource "google_cloudfunctions_function" %s`, hclString(terraformLabel(name))),
+		groups: [][]hclAttr{{
+			{key: "name", value: hclString(name)},
+			{key: "project", value: project},
+			{key: "runtime", value: hclString(flags.runtime)},
+			{key: "entry_point", value: hclString(flags.entrypoint)},
+		}, {
+			{key: "source_archive_bucket", value: "var.source_archive_bucket"},
+			{key: "source_archive_object", value: "var.source_archive_object"},
+		}},
+	}
+
+	options := []hclAttr{}
+	if opts.region != "" {
+		options = append(options, hclAttr{key: "region", value: hclString(opts.region)})
+	}
+	if opts.memory != 0 {
+		options = append(options, hclAttr{key: "available_memory_mb", value: fmt.Sprintf("%d", int(opts.memory))})
+	}
+	if opts.timeout != 0 {
+		options = append(options, hclAttr{key: "timeout", value: fmt.Sprintf("%d", int(opts.timeout.Seconds()))})
+	}
+	if opts.has(optMinInstances) {
+		options = append(options, hclAttr{key: "min_instances", value: fmt.Sprintf("%d", opts.minInstances)})
+	}
+	if opts.has(optMaxInstances) {
+		options = append(options, hclAttr{key: "max_instances", value: fmt.Sprintf("%d", opts.maxInstances)})
+	}
+	if opts.serviceAccount != "" {
+		options = append(options, hclAttr{key: "service_account_email", value: hclString(opts.serviceAccount)})
+	}
+	b.groups = append(b.groups, options, terraformLabels(opts))
+
+	return b
+}
+
+// terraformFunction2 creates the google_cloudfunctions2_function resource block shared by all 2nd gen triggers
+// the location is required for 2nd gen functions, functions without a region are deployed to defaultRegion
+func terraformFunction2(name, project string, flags deployFlags, opts deployOptions) *hclBlock {
+	region := opts.region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	b := &hclBlock{
+		header: fmt.Sprintf(`resource "google_cloudfunctions2_function" %s`, hclString(terraformLabel(name))),
+		groups: [][]hclAttr{{
+			{key: "name", value: hclString(name)},
+			{key: "project", value: project},
+			{key: "location", value: hclString(region)},
+		}, terraformLabels(opts)},
+		blocks: []*hclBlock{{
+			header: "build_config",
+			groups: [][]hclAttr{{
+				{key: "runtime", value: hclString(flags.runtime)},
+				{key: "entry_point", value: hclString(flags.entrypoint)},
+			}},
+			blocks: []*hclBlock{{
+				header: "source",
+				blocks: []*hclBlock{{
+					header: "storage_source",
+					groups: [][]hclAttr{{
+						{key: "bucket", value: "var.source_archive_bucket"},
+						{key: "object", value: "var.source_archive_object"},
+					}},
+				}},
+			}},
+		}},
+	}
+
+	service := []hclAttr{}
+	if opts.memory != 0 {
+		service = append(service, hclAttr{key: "available_memory", value: hclString(fmt.Sprintf("%dM", int(opts.memory)))})
+	}
+	if opts.timeout != 0 {
+		service = append(service, hclAttr{key: "timeout_seconds", value: fmt.Sprintf("%d", int(opts.timeout.Seconds()))})
+	}
+	if opts.has(optMinInstances) {
+		service = append(service, hclAttr{key: "min_instance_count", value: fmt.Sprintf("%d", opts.minInstances)})
+	}
+	if opts.has(optMaxInstances) {
+		service = append(service, hclAttr{key: "max_instance_count", value: fmt.Sprintf("%d", opts.maxInstances)})
+	}
+	if opts.serviceAccount != "" {
+		service = append(service, hclAttr{key: "service_account_email", value: hclString(opts.serviceAccount)})
+	}
+	if len(service) > 0 {
+		b.blocks = append(b.blocks, &hclBlock{header: "service_config", groups: [][]hclAttr{service}})
+	}
+
+	return b
+}
+
+// terraformEventTrigger creates the event_trigger block of a 2nd gen function, nil for events without a 2nd gen trigger
+// the values of the filters match the --trigger-event-filters of DeployCloud
+func terraformEventTrigger(ev CloudDeployFunction, projectRef string) *hclBlock {
+	b := &hclBlock{
+		header: "event_trigger",
+		groups: [][]hclAttr{{{key: "event_type", value: hclString(cloudEventType(ev.Event()))}}},
+	}
+
+	switch ev.Event() {
+	case FirestoreDocumentCreateEvent.Type(), FirestoreDocumentDeleteEvent.Type(), FirestoreDocumentUpdateEvent.Type(), FirestoreDocumentWriteEvent.Type():
+		b.blocks = append(b.blocks,
+			terraformEventFilter("database", hclString(eventDatabase(ev)), false),
+			terraformEventFilter("document", hclString(ev.Resource()), true),
+		)
+
+	case PubSubPublishEvent.Type():
+		b.groups[0] = append(b.groups[0], hclAttr{key: "pubsub_topic", value: fmt.Sprintf(`"projects/%s/topics/%s"`, projectRef, hclEscape(ev.Resource()))})
+
+	case RealtimeDBRefCreateEvent.Type(), RealtimeDBRefDeleteEvent.Type(), RealtimeDBRefUpdateEvent.Type(), RealtimeDBRefWriteEvent.Type():
+		b.groups[0] = append(b.groups[0], hclAttr{key: "trigger_region", value: hclString(eventLocation(ev))})
+		b.blocks = append(b.blocks,
+			terraformEventFilter("instance", fmt.Sprintf(`"%s"`, terraformInstance(ev, projectRef)), false),
+			terraformEventFilter("ref", hclString(ev.Resource()), true),
+		)
+
+	case StorageObjectFinalizeEvent.Type(), StorageObjectArchiveEvent.Type(), StorageObjectDeleteEvent.Type(), StorageObjectMetadataUpdateEvent.Type():
+		b.blocks = append(b.blocks, terraformEventFilter("bucket", hclString(ev.Resource()), false))
+
+	default:
+		return nil
+	}
+
+	return b
+}
+
+// terraformInstance returns the escaped Realtime Database instance of the function, the project reference for functions without an instance
+func terraformInstance(ev CloudDeployFunction, projectRef string) string {
+	if instance := eventInstance(ev, ""); instance != "" {
+		return hclEscape(instance)
+	}
+	return projectRef
+}
+
+// terraformEventFilter creates an event_filters block, the value is written as is
+// path patterns are matched with the match-path-pattern operator, as --trigger-event-filters-path-pattern
+func terraformEventFilter(attribute, value string, pathPattern bool) *hclBlock {
+	attrs := []hclAttr{
+		{key: "attribute", value: hclString(attribute)},
+		{key: "value", value: value},
+	}
+	if pathPattern {
+		attrs = append(attrs, hclAttr{key: "operator", value: hclString("match-path-pattern")})
+	}
+	return &hclBlock{header: "event_filters", groups: [][]hclAttr{attrs}}
+}
+
+// terraformLabels returns the group of the labels attribute, empty when the function has no labels
+func terraformLabels(opts deployOptions) []hclAttr {
+	if len(opts.labels) == 0 {
+		return nil
+	}
+
+	labels := hclAttr{key: "labels"}
+	for _, k := range opts.labelKeys() {
+		labels.entries = append(labels.entries, hclAttr{key: hclString(k), value: hclString(opts.labels[k])})
+	}
+	return []hclAttr{labels}
+}
+
+// terraformLabel converts a function name into a valid terraform resource name
+func terraformLabel(name string) string {
+	label := terraformLabelRegexp.ReplaceAllString(name, "_")
+	if label == "" || (label[0] >= '0' && label[0] <= '9') || label[0] == '-' {
+		label = "_" + label
+	}
+	return label
+}
+
+// deployEvent is a background function to deploy, with its name computed once for the pass, see functionNames
+type deployEvent struct {
+	fn   CloudDeployFunction
+	key  string
+	name string
+}
+
+// deployEvents returns all registered background functions sorted by name, then by trigger
+// topics served by a push subscription are excluded, see FunctionRegistrar.PushSubscription
+func (f *FunctionRegistrar) deployEvents() []deployEvent {
+	names := f.functionNames()
+	evs := make([]deployEvent, 0, len(f.events))
+	for key, ev := range f.events {
+		if p, ok := ev.(*PubSubFunction); ok && p.push {
+			continue
+		}
+		evs = append(evs, deployEvent{fn: ev, key: key, name: names[key]})
+	}
+	sort.Slice(evs, func(i, j int) bool {
+		if evs[i].name != evs[j].name {
+			return evs[i].name < evs[j].name
+		}
+		return evs[i].key < evs[j].key
+	})
+	return evs
+}
+
+// hclAttr is a single attribute within a hclBlock, the value is written as is
+// if entries are provided the attribute is written as a map, and should be the only attribute in its group
+type hclAttr struct {
+	key     string
+	value   string
+	entries []hclAttr
+}
+
+// hclBlock is a minimal writer for HCL blocks
+// attributes within a group are aligned on the "=" sign, groups are separated by an empty line
+// nested blocks are written after all attribute groups
+type hclBlock struct {
+	header string
+	groups [][]hclAttr
+	blocks []*hclBlock
+}
+
+func (b *hclBlock) render(s *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	s.WriteString(fmt.Sprintf("%s%s {\n", indent, b.header))
+
+	n := 0
+	for _, group := range b.groups {
+		if len(group) == 0 {
+			continue
+		}
+		if n > 0 {
+			s.WriteString("\n")
+		}
+		n++
+
+		width := 0
+		for _, a := range group {
+			if len(a.key) > width {
+				width = len(a.key)
+			}
+		}
+
+		for _, a := range group {
+			if a.entries != nil {
+				s.WriteString(fmt.Sprintf("%s  %-*s = {\n", indent, width, a.key))
+				entryWidth := 0
+				for _, e := range a.entries {
+					if len(e.key) > entryWidth {
+						entryWidth = len(e.key)
+					}
+				}
+				for _, e := range a.entries {
+					s.WriteString(fmt.Sprintf("%s    %-*s = %s\n", indent, entryWidth, e.key, e.value))
+				}
+				s.WriteString(fmt.Sprintf("%s  }\n", indent))
+				continue
+			}
+
+			s.WriteString(fmt.Sprintf("%s  %-*s = %s\n", indent, width, a.key, a.value))
+		}
+	}
+
+	for _, nested := range b.blocks {
+		if n > 0 {
+			s.WriteString("\n")
+		}
+		n++
+		nested.render(s, depth+1)
+	}
+
+	s.WriteString(fmt.Sprintf("%s}\n", indent))
+}
+
+func hclVariable(name string) *hclBlock {
+	return &hclBlock{
+		header: fmt.Sprintf("variable %s", hclString(name)),
+		groups: [][]hclAttr{{{key: "type", value: "string"}}},
+	}
+}
+
+// hclString quotes the given string as a HCL string literal
+func hclString(s string) string {
+	return fmt.Sprintf(`"%s"`, hclEscape(s))
+}
+
+// hclEscape escapes the given string for use within a HCL string literal, template sequences are not interpreted
+func hclEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+		"${", "$${",
+		"%{", "%%{",
+	).Replace(s)
+}
@@ -0,0 +1,85 @@
+package register
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files in _testdata")
+
+func goldenFile(t *testing.T, name string, actual string) {
+	t.Helper()
+
+	golden := filepath.Join("_testdata", name+".golden")
+	if *update {
+		err := ioutil.WriteFile(golden, []byte(actual), 0644)
+		if err != nil {
+			t.Fatalf("failed to update golden file %s: %s", golden, err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s: %s", golden, err)
+	}
+
+	assert.Equal(t, string(expected), actual, "output did not match golden file %s", golden)
+}
+
+func TestDeployTerraform(t *testing.T) {
+	reg := NewRegister().WithRegistrar("Registrar").WithProjectID("my-project-id")
+
+	reg.Authentication().Create(nil)
+	reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, nil)
+	reg.Firestore().Collection("users").Document("{uid}").Update(TestFirestoreI{}, nil)
+	reg.PubSub("test-topic").Publish(TestPubSubI{}, nil)
+	reg.RealtimeDB().Ref("messages/{pushId}").Write(TestRTDBI{}, nil)
+	reg.Storage().Bucket("testBucket").Finalize(nil)
+	reg.HTTP("/test", func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Golden", func(t *testing.T) {
+		goldenFile(t, "terraform", reg.DeployTerraform())
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		out := reg.DeployTerraform()
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, out, reg.DeployTerraform(), "output should be deterministic")
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		reg := NewRegister().WithRegistrar("Registrar").AllowUnauthenticated(true)
+		reg.PubSub("test-topic").Publish(TestPubSubI{}, nil)
+		reg.HTTP("/test", func(w http.ResponseWriter, r *http.Request) {})
+
+		goldenFile(t, "terraform_unauthenticated", reg.DeployTerraform())
+	})
+
+	t.Run("Gen2", func(t *testing.T) {
+		reg := NewRegister().WithRegistrar("Registrar").WithProjectID("my-project-id").Gen2(true).AllowUnauthenticated(true)
+		reg.Authentication().Create(nil)
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, nil).Region("europe-west1").Memory(Memory1GB).Labels(map[string]string{"team": "billing"})
+		reg.PubSub("test-topic").Publish(TestPubSubI{}, nil).MaxInstances(5)
+		reg.RealtimeDB().Ref("messages/{pushId}").Write(TestRTDBI{}, nil)
+		reg.Storage().Bucket("testBucket").Finalize(nil).ServiceAccount("fx@my-project-id.iam.gserviceaccount.com")
+		reg.HTTP("/test", func(w http.ResponseWriter, r *http.Request) {}).Timeout(time.Minute)
+
+		out := reg.DeployTerraform()
+		goldenFile(t, "terraform_gen2", out)
+		assert.Contains(t, out, `resource "google_cloudfunctions_function" "auth-user-create"`, "authentication triggers should be deployed as 1st gen functions")
+		assert.NotContains(t, out, `resource "google_cloudfunctions_function" "Registrar"`, "the http function should be deployed as a 2nd gen function")
+	})
+
+	t.Run("Escape", func(t *testing.T) {
+		assert.Equal(t, `"projects/$${x}/%%{y}/\"z\""`, hclString(`projects/${x}/%{y}/"z"`), "template sequences should be escaped")
+		assert.Equal(t, "_1-topic", terraformLabel("1-topic"), "label should not start with a digit")
+		assert.Equal(t, "firestoreDocCreate-users_-uid", terraformLabel("firestoreDocCreate-users/-uid"), "label should replace invalid characters")
+	})
+}
@@ -3,7 +3,9 @@ package register
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -76,3 +78,94 @@ func TestDeployHttp(t *testing.T) {
 		fmt.Println(reg.WithRegistrar("Registrar").DeployHTTP())
 	})
 }
+
+func TestDeployOptions(t *testing.T) {
+	reg := NewRegister().
+		WithRegistrar("Registrar").
+		WithRegion("us-central1").
+		WithMemory(Memory256MB).
+		WithLabels(map[string]string{"team": "core"})
+
+	reg.Firestore().Collection("users").Document("{uid}").
+		Memory(Memory2GB).
+		Timeout(540*time.Second).
+		MaxInstances(10).
+		Labels(map[string]string{"team": "billing"}).
+		Create(TestFirestoreI{}, nil)
+
+	reg.PubSub("test-topic").
+		Region("europe-west1").
+		MinInstances(1).
+		ServiceAccount("fx@my-project-id.iam.gserviceaccount.com").
+		Publish(TestPubSubI{}, nil)
+
+	reg.HTTP("/small", func(w http.ResponseWriter, r *http.Request) {}).Memory(Memory512MB)
+	reg.HTTP("/large", func(w http.ResponseWriter, r *http.Request) {}).Memory(Memory1GB).Timeout(60 * time.Second)
+
+	t.Run("Function Options", func(t *testing.T) {
+		cmd := reg.DeployCloud()
+
+		fs := reg.functionOptions(reg.events[eventKey(FirestoreDocumentCreateEvent.Type(), "users/*")]).String()
+		assert.Equal(t, ` --memory "2048MB" --timeout "540s" --region "us-central1" --max-instances 10 --update-labels "team=billing"`, fs, "function options should override registrar defaults")
+		assert.Contains(t, cmd, fs, "deploy command should contain the function options")
+
+		ps := reg.functionOptions(reg.events[eventKey(PubSubPublishEvent.Type(), "test-topic")]).String()
+		assert.Equal(t, ` --memory "256MB" --region "europe-west1" --min-instances 1 --service-account "fx@my-project-id.iam.gserviceaccount.com" --update-labels "team=core"`, ps, "registrar defaults should apply when unset")
+		assert.Contains(t, cmd, ps, "deploy command should contain the function options")
+	})
+
+	t.Run("Http Options", func(t *testing.T) {
+		opts := reg.httpOptions()
+		assert.Equal(t, Memory1GB, opts.memory, "http memory should be the largest of all routes")
+		assert.Equal(t, 60*time.Second, opts.timeout, "http timeout should be the largest of all routes")
+		assert.Equal(t, "us-central1", opts.region, "http region should fall back to the registrar default")
+		assert.Contains(t, reg.DeployHTTP(), opts.String(), "deploy command should contain the http options")
+	})
+
+	t.Run("Http Region", func(t *testing.T) {
+		reg := NewRegister().WithRegistrar("Registrar")
+		reg.HTTP("/users", func(w http.ResponseWriter, r *http.Request) {}).Region("europe-west1")
+		reg.HTTP("/admin", func(w http.ResponseWriter, r *http.Request) {}).Region("us-east1")
+
+		assert.Equal(t, "europe-west1", reg.httpOptions().region, "http region should be that of the first registered route")
+		cmd := reg.DeployHTTP()
+		assert.True(t, strings.HasSuffix(cmd, ` Registrar --trigger-http --region "europe-west1"`), "deploy command should match: %s", cmd)
+		assert.NotContains(t, cmd, "  ", "deploy command should not contain empty arguments")
+
+		cmd = reg.AllowUnauthenticated(true).DeployHTTP()
+		assert.True(t, strings.HasSuffix(cmd, ` Registrar --trigger-http --allow-unauthenticated --region "europe-west1"`), "deploy command should match: %s", cmd)
+		assert.NotContains(t, cmd, "  ", "deploy command should not contain empty arguments")
+	})
+
+	t.Run("Zero Overrides", func(t *testing.T) {
+		reg := NewRegister().WithMinInstances(1).WithMaxInstances(10).WithTimeout(time.Minute).WithServiceAccount("fx@my-project-id.iam.gserviceaccount.com")
+		reg.PubSub("defaults").Publish(TestPubSubI{}, nil)
+		reg.PubSub("zero").MinInstances(0).MaxInstances(0).Timeout(0).ServiceAccount("").Publish(TestPubSubI{}, nil)
+
+		defaults := reg.functionOptions(reg.events[eventKey(PubSubPublishEvent.Type(), "defaults")]).String()
+		assert.Equal(t, ` --timeout "60s" --min-instances 1 --max-instances 10 --service-account "fx@my-project-id.iam.gserviceaccount.com"`, defaults, "registrar defaults should apply when unset")
+
+		zero := reg.functionOptions(reg.events[eventKey(PubSubPublishEvent.Type(), "zero")]).String()
+		assert.Equal(t, ` --min-instances 0 --clear-max-instances`, zero, "zero values should override the registrar defaults")
+	})
+
+	t.Run("Terraform", func(t *testing.T) {
+		goldenFile(t, "terraform_options", reg.DeployTerraform())
+	})
+}
+
+func TestDeployDatabase(t *testing.T) {
+	reg := NewRegister().WithProjectID("my-project-id")
+	reg.Firestore().Collection("events").Document("{id}").Create(TestFirestoreI{}, nil)
+	reg.Firestore().Database("analytics").Collection("events").Document("{id}").Create(TestFirestoreI{}, nil)
+
+	cmd := reg.DeployCloud()
+	assert.Contains(t, cmd, `firestore-doc-create-events-id --trigger-event "providers/cloud.firestore/eventTypes/document.create" --trigger-resource "projects/my-project-id/databases/(default)/documents/events/{id}"`, "default database should be deployed")
+	assert.Contains(t, cmd, `firestore-doc-create-analytics-events-id --trigger-event "providers/cloud.firestore/eventTypes/document.create" --trigger-resource "projects/my-project-id/databases/analytics/documents/events/{id}"`, "named database should be deployed")
+
+	assert.Contains(t, reg.DeployTerraform(), `"projects/my-project-id/databases/analytics/documents/events/{id}"`, "terraform should use the database")
+
+	reg.Gen2(true)
+	assert.Contains(t, reg.DeployCloud(), `--trigger-event-filters "database=analytics" --trigger-event-filters-path-pattern "document=events/{id}"`, "2nd gen should filter by database")
+	assert.Contains(t, reg.DeployTerraform(), "attribute = \"database\"\n      value     = \"analytics\"", "2nd gen terraform should filter by database")
+}
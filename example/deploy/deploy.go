@@ -2,17 +2,22 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	register "github.com/cleanflo/firebase-fx"
 	functions "github.com/cleanflo/firebase-fx/example"
 )
 
 func main() {
-	fmt.Println(functions.Register.
+	script, err := functions.Register.
 		WithRegistrar("Register").
 		WithProjectID("my-project-id").
 		WithRuntime("go116").
 		Verbosity(register.DebugVerbosity).
-		Deploy(),
-	)
+		DeployE()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(script)
 }
@@ -9,6 +9,7 @@ require (
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/sirupsen/logrus v1.8.1 // indirect
 	golang.org/x/sys v0.0.0-20211210111614-af8b64212486 // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
 )
 
 replace github.com/cleanflo/firebase-fx => ../
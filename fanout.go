@@ -0,0 +1,78 @@
+package register
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HandlerErrors is returned when handlers registered to the same trigger fail and errors are aggregated,
+// see FunctionRegistrar.AggregateErrors. The errors are in the order the handlers were registered
+type HandlerErrors struct {
+	Errors []error
+}
+
+func (e *HandlerErrors) Error() string {
+	s := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		s[i] = err.Error()
+	}
+	return fmt.Sprintf("%d handlers failed: %s", len(e.Errors), strings.Join(s, "; "))
+}
+
+// Is reports whether any of the errors matches target
+func (e *HandlerErrors) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target
+func (e *HandlerErrors) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// AggregateErrors sets how the handlers registered to the same trigger are run when one fails
+// by default the first error stops the remaining handlers and is returned,
+// when set every handler is run and the errors are returned as *HandlerErrors
+//
+// Registering Create, Update, Delete or Write more than once on the same Firestore path, RealtimeDB ref or Storage bucket
+// appends the handler, the handlers are run in the order they were registered and deployed as a single function
+func (f *FunctionRegistrar) AggregateErrors(t bool) *FunctionRegistrar {
+	f.aggregateErrors = t
+	return f
+}
+
+// fanOut runs the handlers registered to the same trigger in the order they were registered
+func (f *FunctionRegistrar) fanOut(handlers []func() error) error {
+	var errs []error
+	for i, h := range handlers {
+		err := h()
+		if err == nil {
+			continue
+		}
+		if !f.aggregateErrors {
+			if i < len(handlers)-1 {
+				Debug.Msgf("fanOut: handler %d of %d failed, skipping the remaining handlers", i+1, len(handlers))
+			}
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &HandlerErrors{Errors: errs}
+}
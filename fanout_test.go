@@ -0,0 +1,117 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOut(t *testing.T) {
+	errTeam := errors.New("team error")
+	firestoreCtx := metadata.NewContext(context.Background(), &metadata.Metadata{
+		EventType: string(FirestoreDocumentUpdateEvent),
+		Resource: &metadata.Resource{
+			RawPath: "projects/[project-name]/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN",
+		},
+	})
+	dec := &Decoder{data: []byte(testFirestoreUpdate)}
+
+	// register adds a handler for each result to the same trigger, recording the order they are called in
+	register := func(reg *FunctionRegistrar, results ...error) *[]int {
+		calls := []int{}
+		for i, result := range results {
+			i, result := i, result
+			reg.Firestore().Collection("testColl").Document("{uid}").Update(TestFirestoreI{}, func(ctx context.Context, e FirestoreEvent) error {
+				calls = append(calls, i)
+				_, ok := e.Value.Fields.(*TestFirestoreI)
+				assert.True(t, ok, "each handler should decode its own data")
+				return result
+			})
+		}
+		return &calls
+	}
+
+	t.Run("Order", func(t *testing.T) {
+		reg := NewRegister()
+		calls := register(reg, nil, nil, nil)
+
+		err := reg.EntryPoint(firestoreCtx, dec)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []int{0, 1, 2}, *calls, "handlers should be called in registration order")
+		assert.Len(t, reg.firestore[FirestoreDocumentUpdateEvent], 1, "handlers should share the trigger")
+	})
+
+	t.Run("Fail Fast", func(t *testing.T) {
+		reg := NewRegister()
+		calls := register(reg, nil, errTeam, nil)
+
+		err := reg.EntryPoint(firestoreCtx, dec)
+		assert.True(t, errors.Is(err, errTeam), "Error should be the failed handler: %s", err)
+		assert.Equal(t, []int{0, 1}, *calls, "handlers after the failure should be skipped")
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		reg := NewRegister().AggregateErrors(true)
+		other := errors.New("other error")
+		calls := register(reg, errTeam, nil, other)
+
+		err := reg.EntryPoint(firestoreCtx, dec)
+		assert.Equal(t, []int{0, 1, 2}, *calls, "every handler should be called")
+		var he *HandlerErrors
+		if assert.True(t, errors.As(err, &he), "Error should be *HandlerErrors: %s", err) {
+			assert.Len(t, he.Errors, 2, "Errors should contain both failures")
+		}
+		assert.True(t, errors.Is(err, errTeam), "Error should contain the first failure")
+		assert.True(t, errors.Is(err, other), "Error should contain the second failure")
+	})
+
+	t.Run("RealtimeDB & Storage", func(t *testing.T) {
+		reg := NewRegister()
+		calls := []string{}
+		for i := 0; i < 2; i++ {
+			i := i
+			reg.RealtimeDB().Ref("testColl/{uid}").Write(TestRTDBI{}, func(ctx context.Context, e RTDBEvent) error {
+				calls = append(calls, fmt.Sprintf("rtdb-%d", i))
+				return nil
+			})
+			reg.Storage().Bucket("testBucket").Finalize(func(ctx context.Context, e StorageEvent) error {
+				calls = append(calls, fmt.Sprintf("storage-%d", i))
+				return nil
+			})
+		}
+
+		rtdbDec := &Decoder{}
+		err := json.Unmarshal([]byte(`{"data":{"NNNNN":1},"delta":{"NNNNN":2}}`), rtdbDec)
+		assert.Nil(t, err, "Error should be nil")
+		err = reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+			EventType: string(RealtimeDBRefWriteEvent),
+			Resource:  &metadata.Resource{RawPath: "projects/_/instances/[project-id]/refs/testColl/1"},
+		}), rtdbDec)
+		assert.Nil(t, err, "Error should be nil")
+
+		err = reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+			EventType: string(StorageObjectFinalizeEvent),
+			Resource:  &metadata.Resource{Name: "projects/_/buckets/testBucket/objects/profile/image.jpg"},
+		}), &Decoder{data: []byte(`{"name": "image.jpg"}`)})
+		assert.Nil(t, err, "Error should be nil")
+
+		assert.Equal(t, []string{"rtdb-0", "rtdb-1", "storage-0", "storage-1"}, calls, "handlers should be called in registration order")
+	})
+
+	t.Run("Deploy", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("{uid}").Memory(Memory512MB).Create(TestFirestoreI{}, nil)
+		reg.Firestore().Collection("users").Document("{uid}").Memory(Memory1GB).Timeout(60*time.Second).Create(TestFirestoreI{}, nil)
+
+		cmd := reg.DeployCloud()
+		assert.Equal(t, 1, strings.Count(cmd, "gcloud functions deploy"), "handlers should be deployed as one function")
+		assert.Contains(t, cmd, `--memory "1024MB" --timeout "60s"`, "options of every handler should be combined")
+	})
+}
@@ -3,10 +3,8 @@ package register
 import (
 	"context"
 	"fmt"
-	"log"
 	"path"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
@@ -15,31 +13,39 @@ import (
 
 const (
 	fsPathBase = "projects/*/databases/*/documents"
+
+	// defaultDatabase is the ID of the database used unless FirestoreFunction.Database is set
+	defaultDatabase = "(default)"
 )
 
 // Firestore returns a new FirestoreFunction with the FunctionRegistrar set to the parent
 func (f *FunctionRegistrar) Firestore() *FirestoreFunction {
 	s := &FirestoreFunction{reg: f}
+	s.target = s
 	return s
 }
 
 // FindFirestore attempts to match the event and path to a registered Firestore function
 // returns the function if found, otherwise nil
 // Uses path.Match to match the given path to the registered path
-// Paths are sorted by length, so the longest path (i.e. most precise) is matched first
+// Paths are sorted by specificity, so the most precise path is matched first
+// only the functions registered to the database of the path are matched
 // expects the full path name as provided by the CloudEvent: "projects/{project-name}/databases/(default)/documents/....."
 func (f *FunctionRegistrar) findFirestore(event FirestoreEventType, ref string) *FirestoreFunction {
 	if f.firestore[event] != nil && len(f.firestore[event]) > 0 {
+		database := firestoreDatabase(ref)
 		ref = breakRef(ref)
 
-		// collect the registered paths
+		// collect the registered paths of the database
 		keys := make(pathKeys, 0, len(f.firestore[event]))
-		for k := range f.firestore[event] {
-			keys = append(keys, k)
+		for k, fs := range f.firestore[event] {
+			if fs.DatabaseID() == database {
+				keys = append(keys, strings.TrimPrefix(k, firestoreKey(database, "")))
+			}
 		}
 
 		if k := findPath(keys, ref); k != "" {
-			fs := f.firestore[event][k]
+			fs := f.firestore[event][firestoreKey(database, k)]
 			return fs
 		}
 	}
@@ -47,15 +53,42 @@ func (f *FunctionRegistrar) findFirestore(event FirestoreEventType, ref string)
 	return nil
 }
 
+// firestoreKey returns the key of a registered path in FunctionRegistrar.firestore
+// paths of the default database are used as is, other databases are prefixed: "databases/{database}/documents/{path}"
+func firestoreKey(database, p string) string {
+	if database == "" || database == defaultDatabase {
+		return p
+	}
+	return fmt.Sprintf("databases/%s/documents/%s", database, p)
+}
+
+// firestoreDatabase returns the database ID of a full document path, "(default)" when the path has no database
+// "projects/{project-name}/databases/{database}/documents/....."
+func firestoreDatabase(ref string) string {
+	parts := strings.Split(ref, "/")
+	if len(parts) >= 5 {
+		if ok, _ := path.Match(fsPathBase, path.Join(parts[:5]...)); ok {
+			return parts[3]
+		}
+	}
+	return defaultDatabase
+}
+
 // FirestoreFunction  is a wrapper for the expected data, FirestoreFunc and the parent FunctionRegistrar
 // Implements the CloudEventFunction interface
 type FirestoreFunction struct {
 	cloudDeployer
+	DeployOptions[*FirestoreFunction]
 	//	.resource  // the following is affixed in requests: projects/[project-name]/databases/(default)/documents/
 	reg           *FunctionRegistrar
 	pathWildcards map[int]string
 	data          interface{}
 	fn            FirestoreFunc
+	database      string               // the ID of the database, "(default)" when empty
+	chain         []*FirestoreFunction // the functions registered before this one on the same trigger
+	strict        bool
+	onlyChanged   []string                    // the FirestoreFunc is skipped unless one of the paths changed
+	onlyIf        []func(FirestoreEvent) bool // the FirestoreFunc is skipped unless all predicates are true
 }
 
 // FirestoreFunc is the function signature for Firestore Cloud Events
@@ -95,6 +128,54 @@ func (f *FirestoreFunction) Document(ref string) *FirestoreFunction {
 	return f
 }
 
+// Database sets the ID of the Firestore database that the FirestoreFunc is executed on, by default "(default)"
+// Must be called before the function is registered with Create, Update, Delete or Write
+//
+//	f.Firestore().Database("analytics").Collection("events").Document("{id}").Create(Event{}, onEvent)
+func (f *FirestoreFunction) Database(id string) *FirestoreFunction {
+	f.database = id
+	return f
+}
+
+// DatabaseID returns the ID of the Firestore database that the FirestoreFunc is executed on: "(default)"
+func (f *FirestoreFunction) DatabaseID() string {
+	if f.database == "" {
+		return defaultDatabase
+	}
+	return f.database
+}
+
+// Named sets the name the function is deployed with, overriding the NamingStrategy of the registrar
+// handlers registered to the same trigger are deployed as one function, with the name set on any of them
+func (f *FirestoreFunction) Named(name string) *FirestoreFunction {
+	f.name = name
+	f.reg.names = nil
+	return f
+}
+
+// Strict fails the event when a field of the payload does not exist in the provided data, or its value does not match the type of the field
+// by default these fields are skipped; values that overflow or fail to parse, and missing required fields always fail the event
+func (f *FirestoreFunction) Strict() *FirestoreFunction {
+	f.strict = true
+	return f
+}
+
+// OnlyIfChanged skips the FirestoreFunc unless one of the given field paths was changed by the event, see FirestoreEvent.Changed
+// Nested fields are separated by a dot: "owner.id". The paths are checked before the fields are decoded
+//
+//	f.Firestore().Collection("orders").Document("{id}").OnlyIfChanged("status", "owner.id").Update(Order{}, onStatusChange)
+func (f *FirestoreFunction) OnlyIfChanged(paths ...string) *FirestoreFunction {
+	f.onlyChanged = append(f.onlyChanged, paths...)
+	return f
+}
+
+// OnlyIf skips the FirestoreFunc unless the predicate returns true, when called multiple times all predicates must return true
+// The predicate receives the event after the fields are decoded, with the path vars available
+func (f *FirestoreFunction) OnlyIf(pred func(e FirestoreEvent) bool) *FirestoreFunction {
+	f.onlyIf = append(f.onlyIf, pred)
+	return f
+}
+
 // Create registers the specified function to the DocumentCreateEvent for Firestore CloudEvent
 // The provided data is used to populate the Value.Fields of the FirestoreEvent received by the function
 //providers/cloud.firestore/eventTypes/document.create
@@ -106,10 +187,12 @@ func (f *FirestoreFunction) Create(data interface{}, fn FirestoreFunc) *Firestor
 		f.reg.firestore[FirestoreDocumentCreateEvent] = make(map[string]*FirestoreFunction)
 	}
 
-	f.reg.firestore[FirestoreDocumentCreateEvent][f.Path()] = f
+	key := firestoreKey(f.database, f.Path())
+	f.chainTo(f.reg.firestore[FirestoreDocumentCreateEvent][key])
+	f.reg.firestore[FirestoreDocumentCreateEvent][key] = f
 
 	f.event = FirestoreDocumentCreateEvent
-	f.reg.events[f.Name()] = f
+	f.reg.addEvent(key, f)
 	return f
 }
 
@@ -124,10 +207,12 @@ func (f *FirestoreFunction) Delete(data interface{}, fn FirestoreFunc) *Firestor
 		f.reg.firestore[FirestoreDocumentDeleteEvent] = make(map[string]*FirestoreFunction)
 	}
 
-	f.reg.firestore[FirestoreDocumentDeleteEvent][f.Path()] = f
+	key := firestoreKey(f.database, f.Path())
+	f.chainTo(f.reg.firestore[FirestoreDocumentDeleteEvent][key])
+	f.reg.firestore[FirestoreDocumentDeleteEvent][key] = f
 
 	f.event = FirestoreDocumentDeleteEvent
-	f.reg.events[f.Name()] = f
+	f.reg.addEvent(key, f)
 	return f
 }
 
@@ -142,10 +227,12 @@ func (f *FirestoreFunction) Update(data interface{}, fn FirestoreFunc) *Firestor
 		f.reg.firestore[FirestoreDocumentUpdateEvent] = make(map[string]*FirestoreFunction)
 	}
 
-	f.reg.firestore[FirestoreDocumentUpdateEvent][f.Path()] = f
+	key := firestoreKey(f.database, f.Path())
+	f.chainTo(f.reg.firestore[FirestoreDocumentUpdateEvent][key])
+	f.reg.firestore[FirestoreDocumentUpdateEvent][key] = f
 
 	f.event = FirestoreDocumentUpdateEvent
-	f.reg.events[f.Name()] = f
+	f.reg.addEvent(key, f)
 	return f
 }
 
@@ -160,34 +247,56 @@ func (f *FirestoreFunction) Write(data interface{}, fn FirestoreFunc) *Firestore
 		f.reg.firestore[FirestoreDocumentWriteEvent] = make(map[string]*FirestoreFunction)
 	}
 
-	f.reg.firestore[FirestoreDocumentWriteEvent][f.Path()] = f
+	key := firestoreKey(f.database, f.Path())
+	f.chainTo(f.reg.firestore[FirestoreDocumentWriteEvent][key])
+	f.reg.firestore[FirestoreDocumentWriteEvent][key] = f
 
 	f.event = FirestoreDocumentWriteEvent
-	f.reg.events[f.Name()] = f
+	f.reg.addEvent(key, f)
 	return f
 }
 
+// chainTo keeps the functions registered before f on the same trigger, they are run before f
+func (f *FirestoreFunction) chainTo(prev *FirestoreFunction) {
+	if prev == nil || prev == f {
+		return
+	}
+	f.chain = append(prev.chain, prev)
+	prev.chain = nil
+	if f.name == "" {
+		// keep the name set on a function registered before f
+		f.name = prev.name
+	}
+}
+
+// deployOptions returns the options of the function combined with the options of the functions chained before it
+func (f *FirestoreFunction) deployOptions() deployOptions {
+	o := deployOptions{}
+	for _, fs := range f.chain {
+		o = o.combine(fs.options)
+	}
+	return o.combine(f.options)
+}
+
 // Path creates a path for the Firestore event that can be used for registering a function
-// returns the path with all wildcard fields replaced with "*"
+// returns the path with all wildcard fields replaced with "*", and recursive wildcards {document=**} replaced with "**"
 // and saves a map of the segment positions var names for access within the function
 func (f *FirestoreFunction) Path() string {
 	pathParts := strings.Split(f.resource, "/")
-	if len(pathParts)%2 == 1 {
-		// we should add an additional wildcard segment to the end of the path
-		// to represent the document id
-		pathParts = append(pathParts, "*")
-	}
-
 	m := make(map[int]string)
 	for i, part := range pathParts {
-		if match := wildcardRegexp.MatchString(part); match {
-			pathParts[i] = "*"
-			m[i] = wildcard(part)
-		} else if part == "*" {
-			m[i] = part
+		if seg, name := pathSegment(part); name != "" {
+			pathParts[i] = seg
+			m[i] = name
 		}
 	}
 
+	if len(pathParts)%2 == 1 && !isRecursivePath(pathParts) {
+		// we should add an additional wildcard segment to the end of the path
+		// to represent the document id
+		pathParts = append(pathParts, "*")
+	}
+
 	f.pathWildcards = m
 
 	return path.Join(pathParts...)
@@ -195,7 +304,8 @@ func (f *FirestoreFunction) Path() string {
 
 // FirestoreEvent is the expected payload for Firestore CloudEvents
 type FirestoreEvent struct {
-	vars map[string]string // map of the segment positions var names for access within the function
+	vars     map[string]string // map of the segment positions var names for access within the function
+	database string            // the ID of the database of the document
 
 	OldValue   FirestoreValue `json:"oldValue"`
 	Value      FirestoreValue `json:"value"`
@@ -213,6 +323,8 @@ type FirestoreValue struct {
 	Fields     interface{} `json:"fields"`
 	Name       string      `json:"name"` // the path of the document
 	UpdateTime time.Time   `json:"updateTime"`
+
+	raw map[string]interface{} // the fields as received, kept when Fields is decoded
 }
 
 // Vars is used to access the segment positions var names for access within the function
@@ -220,285 +332,146 @@ func (e *FirestoreEvent) Vars() map[string]string {
 	return e.vars
 }
 
-// Copy recursively copies the fields received in the FirestoreEvent to the struct provided to the calling FirestoreFunc
-// The struct must have the same fields as the named fields received by the payload
-func (e *FirestoreEvent) Copy(v interface{}) error {
-	Debug.Msgf("copy: starting for %s", e.OldValue.Name)
-	newDataRef, ok := e.Value.Fields.(map[string]interface{})
-	if !ok {
-		return Debug.Errf("copy: value.Fields is not a map: got %s", reflect.TypeOf(e.Value.Fields).String())
-	}
-
-	oldDataRef, ok := e.OldValue.Fields.(map[string]interface{})
-	if !ok {
-		return Debug.Errf("copy: oldValue.Fields is not a map: got %s", reflect.TypeOf(e.Value.Fields).String())
+// Database returns the ID of the database of the document that triggered the event: "(default)"
+func (e *FirestoreEvent) Database() string {
+	if e.database == "" {
+		return defaultDatabase
 	}
+	return e.database
+}
 
-	newData, err := copyFields(newDataRef, v)
-	if err != nil {
-		return Debug.Err("copy: value.Fields failed to copy", err)
-	}
+// IsCreate reports whether the event created the document, OldValue does not exist
+func (e *FirestoreEvent) IsCreate() bool {
+	return !e.OldValue.Exists() && e.Value.Exists()
+}
 
-	oldData, err := copyFields(oldDataRef, v)
-	if err != nil {
-		return Debug.Err("copy: oldValue.Fields failed to copy", err)
-	}
+// IsDelete reports whether the event deleted the document, Value does not exist
+func (e *FirestoreEvent) IsDelete() bool {
+	return e.OldValue.Exists() && !e.Value.Exists()
+}
 
-	e.Value.Fields = newData
-	e.OldValue.Fields = oldData
-	Debug.Msgf("copy: finished for %s", e.OldValue.Name)
+// IsUpdate reports whether the event updated an existing document, both OldValue & Value exist
+func (e *FirestoreEvent) IsUpdate() bool {
+	return e.OldValue.Exists() && e.Value.Exists()
+}
 
-	return nil
+// Exists reports whether the document exists in this version of the event
+// the OldValue of a create event & the Value of a delete event are empty
+func (v *FirestoreValue) Exists() bool {
+	return v.Name != ""
 }
 
-func copyFields(m map[string]interface{}, v interface{}) (n interface{}, err error) {
-	// reflect interface for underlying type
-	dv := reflect.ValueOf(v)
-	if dv.Kind() == reflect.Ptr {
-		if dv.IsNil() {
-			return nil, Debug.Errf("copyfields: value is nil: got %s", reflect.TypeOf(v).String())
-		}
-		// convert pointer to value
-		dv = dv.Elem()
-	}
-	// make sure underlying type is a struct
-	if dv.Kind() != reflect.Struct {
-		return nil, Debug.Errf("copyfields: expected a struct or a pointer to a struct: got %s", dv.Kind())
+// Path returns the path of the document relative to the database: "users/{uid}/orders/{id}"
+// returns an empty string when the document does not exist
+func (v *FirestoreValue) Path() string {
+	if !v.Exists() {
+		return ""
 	}
+	return breakRef(v.Name)
+}
 
-	newData := reflect.New(dv.Type())
-	err = fillStruct(m, newData.Elem())
-	if err != nil {
-		return nil, Debug.Errf("copyfields: failed to fill values: %s = %s: %s", dv.Type().String(), m, err)
+// ID returns the id of the document, the last segment of the path
+func (v *FirestoreValue) ID() string {
+	if !v.Exists() {
+		return ""
 	}
+	return path.Base(v.Path())
+}
 
-	Debug.Msgf("copyfields: destination struct[%s]: %+v", dv.Type(), dv.Interface())
-
-	return newData.Interface(), nil
+// Collection returns the path of the collection containing the document: "users/{uid}/orders"
+func (v *FirestoreValue) Collection() string {
+	if !v.Exists() {
+		return ""
+	}
+	return path.Dir(v.Path())
 }
 
-func fillStruct(m map[string]interface{}, sv reflect.Value) error {
-	Debug.Msgf("fillStruct: starting for %s", sv.Type())
-	// iterate over the fields of the provided data
-	for fieldName, fieldValue := range m {
-		// field underlying type will be map[string]interface{} where the key is the fieldType
-		fieldMap := fieldValue.(map[string]interface{})
-		dataField := sv.FieldByName(fieldName)
-		Debug.Msgf("fillStruct: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), dataField.Kind(), dataField.CanSet(), dataField.IsValid())
-		if dataField.IsValid() && dataField.CanSet() {
-			for k, fv := range fieldMap {
-				setField(k, fv, dataField)
-			}
-		}
+// Parent returns the path of the document containing the collection of the document: "users/{uid}"
+// returns an empty string for documents of a root collection
+func (v *FirestoreValue) Parent() string {
+	parent := path.Dir(v.Collection())
+	if parent == "." {
+		return ""
 	}
+	return parent
+}
 
-	return nil
+// Copy recursively copies the fields received in the FirestoreEvent to the struct provided to the calling FirestoreFunc
+// The struct must have the same fields as the named fields received by the payload, or be tagged with the fx tag
+// Fields is left as nil when the document does not exist: OldValue of a create event, Value of a delete event
+// The fields that failed to decode are returned as a *DecodeError
+func (e *FirestoreEvent) Copy(v interface{}) error {
+	return e.copy(v, false)
 }
 
-func fillMap(m map[string]interface{}, sv reflect.Value) error {
-	Debug.Msgf("fillMap: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), sv.Kind(), sv.CanSet(), sv.IsValid())
-	Debug.Msg("fillMap: value", m)
-	if sv.CanSet() && (sv.IsZero() || sv.IsNil()) {
-		sv.Set(reflect.MakeMap(reflect.TypeOf(m)))
-	}
-
-	if sv.IsValid() && sv.CanSet() {
-		for fieldName, fieldValue := range m {
-			fieldMap := fieldValue.(map[string]interface{})
-			for k, fv := range fieldMap {
-				Debug.Msgf("fillMap: field %s: %s = %v: ", fieldName, k, fv)
-				switch k {
-				case "stringValue", "booleanValue", "integerValue", "doubleValue":
-					sv.SetMapIndex(reflect.ValueOf(fieldName), reflect.ValueOf(fv))
-				case "timestampValue":
-					if fvt, ok := fv.(string); ok {
-						t, err := time.Parse(time.RFC3339, fvt)
-						if err != nil {
-							return Debug.Errf("fillMap: failed to parse timestamp field: %s: %s", fvt, err)
-						}
-						sv.SetMapIndex(reflect.ValueOf(fieldName), reflect.ValueOf(t))
-					}
-				case "geoPointValue":
-
-				case "arrayValue":
-				case "mapValue":
-					if mvt, ok := fv.(map[string]interface{}); ok {
-						if mvft, ok := mvt["fields"]; ok {
-							if mvtFields, ok := mvft.(map[string]interface{}); ok {
-								mp := make(map[string]interface{})
-								mpv := reflect.ValueOf(&mp)
-								msv := mpv.Elem()
-								err := fillMap(mvtFields, msv)
-								if err != nil {
-									return Debug.Errf("fillMap: failed to fill mapValue: %s", err)
-								}
-								sv.SetMapIndex((reflect.ValueOf(fieldName)), msv)
-							}
-						}
-					}
-				}
-			}
-		}
+// copy decodes the fields of both values, strict also reports unknown fields & type mismatches
+func (e *FirestoreEvent) copy(v interface{}, strict bool) error {
+	Debug.Msgf("copy: starting for %s", e.OldValue.Name)
+	d := &fieldDecoder{strict: strict}
+	e.Value.raw = e.Value.rawFields()
+	e.OldValue.raw = e.OldValue.rawFields()
+
+	newData, err := d.copyValue("value", e.Value.Fields, v)
+	if err != nil {
+		return Debug.Errf("copy: value.Fields failed to copy: %w", err)
 	}
-	return nil
-}
 
-func fillSlice(m map[string]interface{}, sv reflect.Value) error {
-	Debug.Msgf("fillSlice: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), sv.Kind(), sv.CanSet(), sv.IsValid())
-	Debug.Msg("fillSlice: values", m)
-	n := 0
-	for fieldName, fieldValue := range m {
-		log.Printf("%s: %v", fieldName, fieldValue)
-		fieldMap := fieldValue.(map[string]interface{})
-		if sv.IsValid() && sv.CanSet() {
-			for k, fv := range fieldMap {
-				mv := sv.Index(n)
-				setField(k, fv, mv)
-				n++
-			}
-		}
+	oldData, err := d.copyValue("oldValue", e.OldValue.Fields, v)
+	if err != nil {
+		return Debug.Errf("copy: oldValue.Fields failed to copy: %w", err)
+	}
+
+	if err := d.err(); err != nil {
+		return Debug.Errf("copy: failed to decode fields of %s: %w", e.Value.Name, err)
 	}
+
+	e.Value.Fields = newData
+	e.OldValue.Fields = oldData
+	Debug.Msgf("copy: finished for %s", e.OldValue.Name)
+
 	return nil
 }
 
-func setField(k string, fv interface{}, dataField reflect.Value) {
-	// switch case on the fieldType and check the following:
-	// 		stringValue, integerValue, booleanValue, doubleValue, nullValue, referenceValue
-	// 		timestampValue, geoPointValue, arrayValue, mapValue
-	switch k {
-	case "stringValue":
-		if fvs, ok := fv.(string); ok && dataField.Kind() == reflect.String {
-			dataField.SetString(fvs)
-		}
-	case "integerValue", "doubleValue":
-		switch x := castInteger(fv).(type) {
-		case int64:
-			switch dataField.Kind() {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				if !dataField.OverflowInt(x) {
-					dataField.SetInt(x)
-				}
-			case reflect.Float32, reflect.Float64:
-				if !dataField.OverflowFloat(float64(x)) {
-					dataField.SetFloat(float64(x))
-				}
-			}
+// copyValue decodes the fields of a FirestoreValue, fields that failed to decode are collected by the fieldDecoder
+func (d *fieldDecoder) copyValue(path string, fields interface{}, v interface{}) (interface{}, error) {
+	if fields == nil {
+		// the document does not exist
+		return nil, nil
+	}
 
-		case float64:
-			switch dataField.Kind() {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				if !dataField.OverflowInt(int64(x)) {
-					dataField.SetInt(int64(x))
-				}
-			case reflect.Float32, reflect.Float64:
-				if !dataField.OverflowFloat(x) {
-					dataField.SetFloat(x)
-				}
-			}
-		case string:
-			switch dataField.Kind() {
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				if a, err := strconv.ParseInt(x, 10, 64); err == nil && !dataField.OverflowInt(a) {
-					dataField.SetInt(a)
-				} else {
-					Debug.Err("setField: failed to parse int:", err)
-				}
-			case reflect.Float32, reflect.Float64:
-				if a, err := strconv.ParseFloat(x, 64); err == nil && !dataField.OverflowFloat(a) {
-					dataField.SetFloat(a)
-					Debug.Err("setField: failed to parse float:", err)
-				}
-			}
-		}
-	case "booleanValue":
-		if fvb, ok := fv.(bool); ok && dataField.Kind() == reflect.Bool {
-			dataField.SetBool(fvb)
-		}
-	case "nullValue":
-		// am not sure if any value can become a nullvalue or a nullvalue is permanently null
-		// if any value can be a null value, this is equivalent to a zero value for the expected type
-	case "referenceValue":
-		if fvr, ok := fv.(string); ok && dataField.Kind() == reflect.String {
-			dataField.SetString(fvr)
-		}
-	case "timestampValue":
-		if fvt, ok := fv.(string); ok && dataField.Type() == reflect.TypeOf(time.Time{}) {
-			t, err := time.Parse(time.RFC3339, fvt)
-			if err != nil {
-				Debug.Errf("setField: failed to parse timestamp field: %s: %v", dataField.Type().Name(), err)
-			}
-			dataField.Set(reflect.ValueOf(t))
-		}
-	case "geoPointValue":
-		// geopoint is a struct with two fields: latitude and longitude
-		// due to this we have to introduce a tags mechanism on the struct fields
-		// if the field has a tag we honour it rather than the field name
-
-	// if the field is an array or map, recurse
-	case "arrayValue":
-		// 	append to the field if array
-		if mvt, ok := fv.(map[string]map[string]interface{}); ok {
-			log.Printf("%s: %v\n", dataField.Kind(), mvt)
-
-			switch dataField.Kind() {
-			case reflect.Slice:
-				err := fillSlice(mvt["values"], dataField)
-				if err != nil {
-					Debug.Errf("setField: failed to fill slice field: %s: %v", dataField.Type().Name(), err)
-				}
-			}
-		}
-	case "mapValue":
-		// get the underlying map which contains the "fields" map
-		if mvt, ok := fv.(map[string]interface{}); ok {
-			if mvft, ok := mvt["fields"]; ok {
-				// make sure fields is a map
-				if mvtFields, ok := mvft.(map[string]interface{}); ok {
-					// check the type underlying the struct field
-					switch dataField.Kind() {
-					case reflect.Map:
-						err := fillMap(mvtFields, dataField)
-						if err != nil {
-							Debug.Errf("setField: failed to fill map field: %s: %v", dataField.Type().Name(), err)
-						}
-					case reflect.Struct:
-						err := fillStruct(mvtFields, dataField)
-						if err != nil {
-							Debug.Errf("setField: failed to fill struct field: %s: %v", dataField.Type().Name(), err)
-						}
-					}
-				}
-			}
-		}
+	m, ok := fields.(map[string]interface{})
+	if !ok {
+		return nil, Debug.Errf("copy: %s.Fields is not a map: got %s", path, reflect.TypeOf(fields).String())
 	}
-}
 
-func castInteger(v interface{}) interface{} {
-	switch n := v.(type) {
-	case int:
-		return int64(n)
-	case int8:
-		return int64(n)
-	case int16:
-		return int64(n)
-	case int32:
-		return int64(n)
-	case int64:
-		return int64(n)
-	case float32:
-		return float64(n)
-	case float64:
-		return float64(n)
-	case string:
-		return n
+	n, err := d.copyFields(path, m, v)
+	if _, ok := err.(*DecodeError); ok {
+		// reported once both values are decoded
+		return nil, nil
 	}
-	return nil
+	return n, err
 }
 
 // CloudEventFunction
 
 // HandleCloudEvent handles the Firebase Firestore CloudEvent and calls the registered FirestoreFunction
+// every FirestoreFunc registered to the trigger is called in the order they were registered
 func (a *FirestoreFunction) HandleCloudEvent(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	handlers := make([]func() error, 0, len(a.chain)+1)
+	for _, fs := range a.chain {
+		fs := fs
+		handlers = append(handlers, func() error { return fs.handle(ctx, md, dec) })
+	}
+	handlers = append(handlers, func() error { return a.handle(ctx, md, dec) })
+	return a.reg.fanOut(handlers)
+}
+
+// handle decodes the event for the data of the function and calls its FirestoreFunc
+func (a *FirestoreFunction) handle(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	if a.fn == nil {
+		return Debug.Errf("no FirestoreFunc registered for [%s]: %s: %w", md.EventType, a.Resource(), ErrNilHandler)
+	}
+
 	evt := FirestoreEvent{}
 	err := dec.Decode(&evt)
 	if err != nil {
@@ -507,24 +480,41 @@ func (a *FirestoreFunction) HandleCloudEvent(ctx context.Context, md *metadata.M
 		return Debug.Errf(s, err)
 	}
 
+	if len(a.onlyChanged) > 0 && !evt.ChangedAny(a.onlyChanged...) {
+		Debug.Msgf("skipped firestorefunc [%s]: %s: none of the fields changed: %v", md.EventType, a.Name(), a.onlyChanged)
+		return nil
+	}
+
 	if a.data != nil {
-		err = evt.Copy(a.data)
+		err = evt.copy(a.data, a.strict)
 		if err != nil {
-			return Debug.Errf("failed to copy firestore event [%s]: %s: %s", md.EventType, err, string(dec.data))
+			Debug.Msgf("failed to copy firestore event [%s]: %s: %s", md.EventType, err, string(dec.data))
+			return Debug.Errf("failed to copy firestore event [%s]: %w", md.EventType, err)
+		}
+	}
+
+	// the value of a deleted document is empty, the resource is always the path of the document
+	evt.vars = extractVars(breakRef(md.Resource.RawPath), a.pathWildcards)
+	evt.database = firestoreDatabase(md.Resource.RawPath)
+
+	for i, pred := range a.onlyIf {
+		if !pred(evt) {
+			Debug.Msgf("skipped firestorefunc [%s]: %s: predicate %d returned false", md.EventType, a.Name(), i)
+			return nil
 		}
 	}
 
-	evt.vars = extractVars(breakRef(evt.Value.Name), a.pathWildcards)
 	err = a.fn(ctx, evt)
 	if err != nil {
-		return Debug.Errf("registered firestorefunc failed [%s]: %s: FirestoreFunc %+v", md.EventType, err, a)
+		return Debug.Errf("registered firestorefunc failed [%s]: %w: FirestoreFunc %+v", md.EventType, err, a)
 	}
 	return nil
 }
 
-// Name returns the name of the function: "firestore.doc.{create,delete,update,write}"
+// Name returns the name of the function: "firestore-doc-create-users-uid", see FunctionRegistrar.WithNaming
+// functions of a named database include the database: "firestore-doc-create-analytics-events-id"
 func (a *FirestoreFunction) Name() string {
-	return fmt.Sprintf("%s-%s", a.event, normalizeRegexp.ReplaceAllString(a.Resource(), "-$1"))
+	return a.reg.functionName(a)
 }
 
 // Resource returns the resource of the function: "collection/{document-id}/...."
@@ -0,0 +1,247 @@
+package register
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var simpleFieldRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z_0-9]*$`)
+
+// FieldChange holds the value of a field path before and after the event
+// Old or New is nil when the field does not exist in that version of the document
+type FieldChange struct {
+	Old interface{}
+	New interface{}
+}
+
+// Changed reports whether the given field path was changed by the event, nested fields are separated by a dot: "MS.B"
+// field names that are not simple identifiers are quoted with backticks: "labels.`app.kubernetes.io`"
+// For update events the UpdateMask is used, a path is changed when it, a parent, or a child of it is in the mask
+// otherwise the fields of OldValue & Value are compared, so created and deleted documents report every field as changed
+func (e *FirestoreEvent) Changed(path string) bool {
+	segs := splitFieldPath(path)
+	if len(segs) == 0 {
+		return false
+	}
+
+	if len(e.UpdateMask.FieldPaths) > 0 {
+		for _, p := range e.UpdateMask.FieldPaths {
+			mask := splitFieldPath(p)
+			if hasFieldPrefix(segs, mask) || hasFieldPrefix(mask, segs) {
+				return true
+			}
+		}
+		return false
+	}
+
+	oldValue, oldOk := rawValue(e.OldValue.rawFields(), segs)
+	newValue, newOk := rawValue(e.Value.rawFields(), segs)
+	return oldOk != newOk || !reflect.DeepEqual(oldValue, newValue)
+}
+
+// ChangedAny reports whether any of the given field paths was changed by the event, see Changed
+func (e *FirestoreEvent) ChangedAny(paths ...string) bool {
+	for _, p := range paths {
+		if e.Changed(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the old and new values of every changed field path
+// For update events the paths of the UpdateMask are used, otherwise the leaf fields that differ between OldValue & Value
+// The values are taken from the decoded Fields when they contain the path, and from the received fields otherwise
+func (e *FirestoreEvent) Diff() map[string]FieldChange {
+	paths := e.UpdateMask.FieldPaths
+	if len(paths) == 0 {
+		paths = diffFieldPaths(nil, e.OldValue.rawFields(), e.Value.rawFields())
+	}
+
+	diff := make(map[string]FieldChange, len(paths))
+	for _, p := range paths {
+		c := FieldChange{}
+		c.Old, _ = e.OldValue.Field(p)
+		c.New, _ = e.Value.Field(p)
+		diff[p] = c
+	}
+	return diff
+}
+
+// Field returns the value of the given field path, nested fields are separated by a dot: "MS.B"
+// When Fields has been decoded to a struct the value is read from the struct, this includes the fx tag names
+// otherwise the received value is converted as it would be for a map[string]interface{}
+// returns false when the field does not exist
+func (v *FirestoreValue) Field(path string) (interface{}, bool) {
+	segs := splitFieldPath(path)
+	if len(segs) == 0 {
+		return nil, false
+	}
+
+	if _, ok := v.Fields.(map[string]interface{}); !ok && v.Fields != nil {
+		if fv, ok := structValue(reflect.ValueOf(v.Fields), segs); ok {
+			return fv, true
+		}
+	}
+
+	wire, ok := rawValue(v.rawFields(), segs)
+	if !ok {
+		return nil, false
+	}
+	for k, fv := range wire {
+		value, ok := (&fieldDecoder{}).interfaceValue(path, k, fv)
+		return value, ok
+	}
+	return nil, false
+}
+
+// rawFields returns the fields as they were received
+func (v *FirestoreValue) rawFields() map[string]interface{} {
+	if v.raw != nil {
+		return v.raw
+	}
+	m, _ := v.Fields.(map[string]interface{})
+	return m
+}
+
+// rawValue returns the typed value at the given path of the received fields: {"stringValue": "..."}
+func rawValue(fields map[string]interface{}, segs []string) (map[string]interface{}, bool) {
+	for i, seg := range segs {
+		value, ok := fields[seg].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if i == len(segs)-1 {
+			return value, true
+		}
+
+		mv, ok := value["mapValue"].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		fields, _ = mv["fields"].(map[string]interface{})
+	}
+	return nil, false
+}
+
+// structValue returns the value at the given path of a decoded struct, following struct fields & string keyed maps
+func structValue(v reflect.Value, segs []string) (interface{}, bool) {
+	for _, seg := range segs {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			sf, ok := lookupField(structFields(v.Type()), seg)
+			if !ok {
+				return nil, false
+			}
+			v, ok = fieldByIndex(v, sf.index, false)
+			if !ok {
+				return nil, false
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			v = v.MapIndex(reflect.ValueOf(seg).Convert(v.Type().Key()))
+			if !v.IsValid() {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return v.Interface(), true
+}
+
+// diffFieldPaths returns the paths of the leaf fields that differ between old & new, nested maps are compared by field
+func diffFieldPaths(parent []string, old, new map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for k := range old {
+		keys[k] = true
+	}
+	for k := range new {
+		keys[k] = true
+	}
+
+	paths := []string{}
+	for k := range keys {
+		segs := append(append([]string{}, parent...), k)
+		o, oldOk := old[k].(map[string]interface{})
+		n, newOk := new[k].(map[string]interface{})
+		if reflect.DeepEqual(o, n) && oldOk == newOk {
+			continue
+		}
+
+		om, oldMap := o["mapValue"].(map[string]interface{})
+		nm, newMap := n["mapValue"].(map[string]interface{})
+		if oldMap && newMap {
+			of, _ := om["fields"].(map[string]interface{})
+			nf, _ := nm["fields"].(map[string]interface{})
+			paths = append(paths, diffFieldPaths(segs, of, nf)...)
+			continue
+		}
+
+		paths = append(paths, joinFieldPath(segs))
+	}
+	return paths
+}
+
+// splitFieldPath splits a Firestore field path into its segments, backtick quoted segments may contain dots
+func splitFieldPath(path string) []string {
+	segs := []string{}
+	seg := strings.Builder{}
+	quoted, escaped := false, false
+	for _, r := range path {
+		switch {
+		case escaped:
+			seg.WriteRune(r)
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '`':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			segs = append(segs, seg.String())
+			seg.Reset()
+		default:
+			seg.WriteRune(r)
+		}
+	}
+	if path != "" {
+		segs = append(segs, seg.String())
+	}
+	return segs
+}
+
+// joinFieldPath joins the segments of a field path, quoting segments that are not simple identifiers
+func joinFieldPath(segs []string) string {
+	s := make([]string, len(segs))
+	for i, seg := range segs {
+		if simpleFieldRegexp.MatchString(seg) {
+			s[i] = seg
+			continue
+		}
+		s[i] = "`" + strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(seg) + "`"
+	}
+	return strings.Join(s, ".")
+}
+
+// hasFieldPrefix reports whether the field path segs starts with prefix
+func hasFieldPrefix(segs, prefix []string) bool {
+	if len(prefix) > len(segs) {
+		return false
+	}
+	for i := range prefix {
+		if segs[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirestoreChanges(t *testing.T) {
+	event := func(t *testing.T, s string) FirestoreEvent {
+		evt := FirestoreEvent{}
+		err := json.Unmarshal([]byte(s), &evt)
+		if err != nil {
+			t.Fatalf("Error unmarshalling test firestore event: %v", err)
+		}
+		return evt
+	}
+
+	t.Run("UpdateMask", func(t *testing.T) {
+		evt := event(t, testFirestoreUpdate)
+
+		assert.True(t, evt.Changed("MS.B"), "MS.B should be changed")
+		assert.True(t, evt.Changed("MS"), "MS should be changed, MS.B is a child")
+		assert.True(t, evt.Changed("MS.B.C"), "MS.B.C should be changed, MS.B is a parent")
+		assert.False(t, evt.Changed("MS.A"), "MS.A should not be changed")
+		assert.False(t, evt.Changed("BB"), "BB should not be changed")
+		assert.False(t, evt.Changed(""), "empty path should not be changed")
+
+		assert.True(t, evt.ChangedAny("BB", "MS.B"), "ChangedAny should include MS.B")
+		assert.False(t, evt.ChangedAny("BB", "NNNNN"), "ChangedAny should not include BB or NNNNN")
+		assert.False(t, evt.ChangedAny(), "ChangedAny without paths should not be changed")
+	})
+
+	t.Run("Diff Raw", func(t *testing.T) {
+		evt := event(t, testFirestoreUpdate)
+
+		assert.Equal(t, map[string]FieldChange{
+			"MS.B": {Old: "6544", New: "1234"},
+		}, evt.Diff(), "Diff should contain the raw values of MS.B")
+	})
+
+	t.Run("Diff Decoded", func(t *testing.T) {
+		evt := event(t, testFirestoreUpdate)
+		err := evt.Copy(TestFirestoreI{})
+		assert.Nil(t, err, "Error should be nil")
+
+		assert.True(t, evt.Changed("MS.B"), "MS.B should be changed")
+		assert.Equal(t, map[string]FieldChange{
+			"MS.B": {Old: 6544, New: 1234},
+		}, evt.Diff(), "Diff should contain the decoded values of MS.B")
+
+		v, ok := evt.Value.Field("geo")
+		assert.True(t, ok, "geo should exist")
+		assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, v, "geo should be read from the fx tagged field")
+
+		v, ok = evt.Value.Field("M.Asd")
+		assert.True(t, ok, "M.Asd should exist")
+		assert.Equal(t, "2355", v, "M.Asd should be read from the decoded map")
+
+		_, ok = evt.Value.Field("Missing")
+		assert.False(t, ok, "Missing should not exist")
+	})
+
+	t.Run("Compare Values", func(t *testing.T) {
+		evt := event(t, `{
+			"oldValue": {"fields": {
+				"status": {"stringValue": "open"},
+				"owner": {"mapValue": {"fields": {"id": {"stringValue": "a"}, "name": {"stringValue": "Jane"}}}},
+				"labels": {"mapValue": {"fields": {"app.kubernetes.io": {"stringValue": "fx"}}}},
+				"removed": {"booleanValue": true}
+			}},
+			"value": {"fields": {
+				"status": {"stringValue": "closed"},
+				"owner": {"mapValue": {"fields": {"id": {"stringValue": "b"}, "name": {"stringValue": "Jane"}}}},
+				"labels": {"mapValue": {"fields": {"app.kubernetes.io": {"stringValue": "firebase-fx"}}}},
+				"added": {"integerValue": "1"}
+			}}
+		}`)
+
+		assert.True(t, evt.Changed("status"), "status should be changed")
+		assert.True(t, evt.Changed("owner.id"), "owner.id should be changed")
+		assert.False(t, evt.Changed("owner.name"), "owner.name should not be changed")
+		assert.True(t, evt.Changed("labels.`app.kubernetes.io`"), "quoted paths should be changed")
+		assert.True(t, evt.Changed("removed"), "removed should be changed")
+		assert.True(t, evt.Changed("added"), "added should be changed")
+
+		assert.Equal(t, map[string]FieldChange{
+			"status":                     {Old: "open", New: "closed"},
+			"owner.id":                   {Old: "a", New: "b"},
+			"labels.`app.kubernetes.io`": {Old: "fx", New: "firebase-fx"},
+			"removed":                    {Old: true, New: nil},
+			"added":                      {Old: nil, New: "1"},
+		}, evt.Diff(), "Diff should contain the leaf fields that differ")
+	})
+
+	t.Run("Created", func(t *testing.T) {
+		evt := event(t, `{"oldValue": {}, "value": {"fields": {"status": {"stringValue": "open"}}}}`)
+
+		assert.True(t, evt.Changed("status"), "status should be changed for a created document")
+		assert.False(t, evt.Changed("owner"), "owner should not be changed")
+		assert.Equal(t, map[string]FieldChange{
+			"status": {Old: nil, New: "open"},
+		}, evt.Diff(), "Diff should contain every field of a created document")
+	})
+}
+
+func TestFirestoreFilters(t *testing.T) {
+	hook := logtest.NewGlobal()
+	SetLogLevel(Debug)
+	defer log.SetLevel(log.FatalLevel)
+
+	ctx := metadata.NewContext(context.Background(), &metadata.Metadata{
+		EventType: string(FirestoreDocumentUpdateEvent),
+		Resource: &metadata.Resource{
+			RawPath: "projects/[project-name]/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN",
+		},
+	})
+	dec := &Decoder{data: []byte(testFirestoreUpdate)}
+
+	skipped := func() bool {
+		for _, e := range hook.AllEntries() {
+			if e.Level == log.DebugLevel && strings.HasPrefix(e.Message, "skipped firestorefunc") {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name   string
+		filter func(f *FirestoreFunction) *FirestoreFunction
+		called bool
+	}{
+		{"Changed", func(f *FirestoreFunction) *FirestoreFunction { return f.OnlyIfChanged("BB", "MS.B") }, true},
+		{"Changed Parent", func(f *FirestoreFunction) *FirestoreFunction { return f.OnlyIfChanged("MS") }, true},
+		{"Not Changed", func(f *FirestoreFunction) *FirestoreFunction { return f.OnlyIfChanged("BB", "MS.A") }, false},
+		{"Predicate", func(f *FirestoreFunction) *FirestoreFunction {
+			return f.OnlyIf(func(e FirestoreEvent) bool {
+				v, ok := e.Value.Fields.(*TestFirestoreI)
+				return ok && v.MS.B > 1000 && e.Vars()["uid"] == "5914E2YLVWcUDHisQwQN"
+			})
+		}, true},
+		{"Predicate False", func(f *FirestoreFunction) *FirestoreFunction {
+			return f.OnlyIf(func(e FirestoreEvent) bool { return true }).OnlyIf(func(e FirestoreEvent) bool { return false })
+		}, false},
+		{"Changed & Predicate", func(f *FirestoreFunction) *FirestoreFunction {
+			return f.OnlyIfChanged("MS.B").OnlyIf(func(e FirestoreEvent) bool { return e.Changed("MS.B") })
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+			reg := NewRegister()
+			called := false
+			tt.filter(reg.Firestore().Collection("testColl").Document("{uid}")).Update(TestFirestoreI{}, func(ctx context.Context, e FirestoreEvent) error {
+				called = true
+				return nil
+			})
+
+			err := reg.EntryPoint(ctx, dec)
+			assert.Nil(t, err, "Error should be nil")
+			assert.Equal(t, tt.called, called, "FirestoreFunc called")
+			assert.Equal(t, !tt.called, skipped(), "skip should be logged at debug level")
+		})
+	}
+}
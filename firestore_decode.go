@@ -0,0 +1,878 @@
+package register
+
+import (
+	"database/sql"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRequiredField is returned for fields tagged `fx:",required"` that are missing from the payload
+	ErrRequiredField = errors.New("required field is missing")
+	// ErrUnknownField is returned in strict mode for fields that do not exist in the destination struct
+	ErrUnknownField = errors.New("unknown field")
+	// ErrTypeMismatch is returned in strict mode for values that cannot be stored in the destination type
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrOverflow is returned for numbers that do not fit in the destination type
+	ErrOverflow = errors.New("value overflows type")
+	// ErrMalformed is returned for values that do not have the structure of a Firestore value
+	ErrMalformed = errors.New("malformed value")
+)
+
+// FieldError describes a single Firestore field that could not be decoded or encoded
+type FieldError struct {
+	Path     string // the path of the field: "value.MS.B" or "value.Tags[1]"
+	WireType string // the Firestore value type: "integerValue"
+	GoType   string // the Go type of the field: "int8"
+	Err      error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s into %s: %s", e.Path, e.WireType, e.GoType, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is returned when one or more Firestore fields could not be decoded
+// errors.Is can be used to check for ErrRequiredField, ErrUnknownField, ErrTypeMismatch, ErrOverflow & ErrMalformed
+type DecodeError struct {
+	Errors []*FieldError
+}
+
+func (e *DecodeError) Error() string {
+	s := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		s[i] = fe.Error()
+	}
+	return fmt.Sprintf("failed to decode %d firestore field(s): %s", len(e.Errors), strings.Join(s, "; "))
+}
+
+// Is reports whether any of the field errors matches the target
+func (e *DecodeError) Is(target error) bool {
+	for _, fe := range e.Errors {
+		if errors.Is(fe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// FirestoreUnmarshaler is implemented by types that decode themselves from a Firestore value,
+// it takes precedence over all other decoding, including nullValue
+// wireType is the Firestore value type: "stringValue", "integerValue", "mapValue"...
+// raw is the value as received: integers are strings, maps are {"fields": {...}} & arrays are {"values": [...]}
+//
+// types implementing encoding.TextUnmarshaler are decoded from a stringValue with UnmarshalText
+type FirestoreUnmarshaler interface {
+	UnmarshalFirestore(wireType string, raw interface{}) error
+}
+
+// GeoPoint is the Go representation of a Firestore geoPointValue
+// any struct with fields tagged `fx:"latitude"` & `fx:"longitude"` can be used in its place
+type GeoPoint struct {
+	Latitude  float64 `fx:"latitude"`
+	Longitude float64 `fx:"longitude"`
+}
+
+// structField describes a struct field that can be populated from a Firestore field
+type structField struct {
+	name      string // the Firestore field name
+	index     []int  // the index sequence of the field, through embedded structs
+	tagged    bool   // the name is taken from an fx or json tag
+	required  bool   // the Firestore field must be present in the payload
+	reference bool   // the string field is encoded as a referenceValue
+}
+
+// structFields returns the fields of a struct type keyed by the Firestore field name.
+// The name is taken from the fx tag, then the json tag, otherwise the Go field name is used:
+//
+//	Name    string    `fx:"name"`            // populated from the "name" field
+//	Email   string    `fx:"email,required"`  // fails the decoding when "email" is not present
+//	Secret  string    `fx:"-"`               // never populated
+//	Owner   string    `fx:"owner,reference"` // encoded as a referenceValue by MarshalFirestoreFields
+//	Created time.Time `json:"createdAt"`     // populated from the "createdAt" field
+//	Age     int                              // populated from the "Age" field
+//
+// Firestore fields are matched to the exact name first, then case-insensitively: "age" populates Age
+//
+// The fields of embedded structs & pointers to structs are promoted as they are by encoding/json,
+// a shallower field hides a deeper field with the same name, at the same depth a tagged field hides an untagged one
+// and fields that are still ambiguous are ignored. Embedded structs with a tag name are decoded from a mapValue.
+func structFields(t reflect.Type) map[string]structField {
+	fields := map[string]structField{}
+	ambiguous := map[string]bool{}
+
+	var walk func(t reflect.Type, index []int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, visited map[reflect.Type]bool) {
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			ft := sf.Type
+			if sf.Anonymous && ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if sf.PkgPath != "" && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+				// unexported, the exported fields of unexported embedded structs are still promoted
+				continue
+			}
+
+			f, ok := tagField(sf)
+			if !ok {
+				continue
+			}
+			f.index = append(append(make([]int, 0, len(index)+1), index...), i)
+
+			if sf.Anonymous && !f.tagged && ft.Kind() == reflect.Struct {
+				if !visited[ft] {
+					walk(ft, f.index, visited)
+				}
+				continue
+			}
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			existing, ok := fields[f.name]
+			switch {
+			case !ok, len(f.index) < len(existing.index):
+			case len(f.index) > len(existing.index), existing.tagged && !f.tagged:
+				continue
+			case existing.tagged == f.tagged:
+				ambiguous[f.name] = true
+				continue
+			}
+			fields[f.name] = f
+			delete(ambiguous, f.name)
+		}
+	}
+	walk(t, nil, map[reflect.Type]bool{})
+
+	for name := range ambiguous {
+		Debug.Msgf("structFields: field %s: ambiguous in %s", name, t)
+		delete(fields, name)
+	}
+	return fields
+}
+
+// tagField returns the name & options of a struct field from its fx or json tags, false when the field is skipped
+func tagField(sf reflect.StructField) (structField, bool) {
+	f := structField{name: sf.Name}
+
+	if tag, ok := sf.Tag.Lookup("fx"); ok {
+		opts := strings.Split(tag, ",")
+		if opts[0] == "-" && len(opts) == 1 {
+			return f, false
+		}
+		if opts[0] != "" {
+			f.name, f.tagged = opts[0], true
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "required":
+				f.required = true
+			case "reference":
+				f.reference = true
+			}
+		}
+	}
+
+	if tag, ok := sf.Tag.Lookup("json"); ok && !f.tagged {
+		name := strings.Split(tag, ",")[0]
+		if tag == "-" {
+			return f, false
+		}
+		if name != "" {
+			f.name, f.tagged = name, true
+		}
+	}
+
+	return f, true
+}
+
+// lookupField returns the struct field for a Firestore field name, matching the exact name first then case-insensitively
+func lookupField(fields map[string]structField, name string) (structField, bool) {
+	if f, ok := fields[name]; ok {
+		return f, true
+	}
+
+	var found []structField
+	for n, f := range fields {
+		if strings.EqualFold(n, name) {
+			found = append(found, f)
+		}
+	}
+	if len(found) != 1 {
+		// an ambiguous match is not a match
+		return structField{}, false
+	}
+	return found[0], true
+}
+
+// fieldByIndex returns the nested field of sv with the index sequence of a structField
+// nil embedded pointers are allocated when alloc is set, otherwise false is returned
+func fieldByIndex(sv reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && sv.Kind() == reflect.Ptr {
+			if sv.IsNil() {
+				if !alloc || !sv.CanSet() {
+					return reflect.Value{}, false
+				}
+				sv.Set(reflect.New(sv.Type().Elem()))
+			}
+			sv = sv.Elem()
+		}
+		sv = sv.Field(x)
+	}
+	return sv, true
+}
+
+// fieldDecoder fills Go values from Firestore fields and collects the fields that failed to decode
+// errors that lose data (overflow, unparsable values, malformed payloads, missing required fields) are always collected
+// in strict mode unknown fields & values that do not match the destination type are collected as well
+type fieldDecoder struct {
+	strict bool
+	errs   []*FieldError
+}
+
+// fail records a field that failed to decode
+func (d *fieldDecoder) fail(path, wireType string, t reflect.Type, err error) {
+	goType := "<nil>"
+	if t != nil {
+		goType = t.String()
+	}
+	fe := &FieldError{Path: path, WireType: wireType, GoType: goType, Err: err}
+	Debug.Msgf("fieldDecoder: %s", fe)
+	d.errs = append(d.errs, fe)
+}
+
+// mismatch records a value that cannot be stored in the destination type, only in strict mode
+func (d *fieldDecoder) mismatch(path, wireType string, t reflect.Type) {
+	if d.strict {
+		d.fail(path, wireType, t, ErrTypeMismatch)
+	}
+}
+
+// err returns a *DecodeError for the collected fields, or nil
+func (d *fieldDecoder) err() error {
+	if len(d.errs) == 0 {
+		return nil
+	}
+	return &DecodeError{Errors: d.errs}
+}
+
+// fieldPath joins a field name to the path of its parent
+func fieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func copyFields(m map[string]interface{}, v interface{}) (n interface{}, err error) {
+	return (&fieldDecoder{}).copyFields("", m, v)
+}
+
+// copyFields creates a new value of the type of v and fills it with the fields of m
+func (d *fieldDecoder) copyFields(path string, m map[string]interface{}, v interface{}) (n interface{}, err error) {
+	// reflect interface for underlying type
+	dv := reflect.ValueOf(v)
+	if dv.Kind() == reflect.Ptr {
+		if dv.IsNil() {
+			return nil, Debug.Errf("copyfields: value is nil: got %s", reflect.TypeOf(v).String())
+		}
+		// convert pointer to value
+		dv = dv.Elem()
+	}
+	// make sure underlying type is a struct
+	if dv.Kind() != reflect.Struct {
+		return nil, Debug.Errf("copyfields: expected a struct or a pointer to a struct: got %s", dv.Kind())
+	}
+
+	newData := reflect.New(dv.Type())
+	d.fillStruct(path, m, newData.Elem())
+	if err := d.err(); err != nil {
+		return nil, err
+	}
+
+	Debug.Msgf("copyfields: destination struct[%s]: %+v", dv.Type(), newData.Elem().Interface())
+
+	return newData.Interface(), nil
+}
+
+func (d *fieldDecoder) fillStruct(path string, m map[string]interface{}, sv reflect.Value) {
+	Debug.Msgf("fillStruct: starting for %s", sv.Type())
+	fields := structFields(sv.Type())
+	found := map[string]bool{}
+
+	// iterate over the fields of the provided data
+	for fieldName, fieldValue := range m {
+		fp := fieldPath(path, fieldName)
+		sf, ok := lookupField(fields, fieldName)
+		if _, exact := m[sf.name]; ok && exact && sf.name != fieldName {
+			// the exact name is also present: "Name" takes precedence over "name"
+			ok = false
+		}
+		if !ok {
+			Debug.Msgf("fillStruct: field %s: not found in %s", fieldName, sv.Type())
+			if d.strict {
+				d.fail(fp, wireType(fieldValue), sv.Type(), ErrUnknownField)
+			}
+			continue
+		}
+		found[sf.name] = true
+
+		dataField, ok := fieldByIndex(sv, sf.index, true)
+		if !ok {
+			Debug.Msgf("fillStruct: field %s: cannot allocate embedded struct in %s", fieldName, sv.Type())
+			d.mismatch(fp, wireType(fieldValue), sv.Type())
+			continue
+		}
+
+		// field underlying type will be map[string]interface{} where the key is the fieldType
+		fieldMap, ok := fieldValue.(map[string]interface{})
+		if !ok {
+			d.fail(fp, "", dataField.Type(), ErrMalformed)
+			continue
+		}
+
+		Debug.Msgf("fillStruct: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), dataField.Kind(), dataField.CanSet(), dataField.IsValid())
+		if dataField.IsValid() && dataField.CanSet() {
+			for k, fv := range fieldMap {
+				d.setField(fp, k, fv, dataField)
+			}
+		}
+	}
+
+	for _, sf := range fields {
+		if sf.required && !found[sf.name] {
+			d.fail(fieldPath(path, sf.name), "", sv.Type().FieldByIndex(sf.index).Type, ErrRequiredField)
+		}
+	}
+}
+
+func (d *fieldDecoder) fillMap(path string, m map[string]interface{}, sv reflect.Value) {
+	Debug.Msgf("fillMap: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), sv.Kind(), sv.CanSet(), sv.IsValid())
+	Debug.Msg("fillMap: value", m)
+	if !sv.IsValid() || !sv.CanSet() {
+		return
+	}
+
+	if sv.Type().Key().Kind() != reflect.String {
+		d.mismatch(path, "mapValue", sv.Type())
+		return
+	}
+
+	if sv.IsNil() {
+		sv.Set(reflect.MakeMap(sv.Type()))
+	}
+
+	elemType := sv.Type().Elem()
+	for fieldName, fieldValue := range m {
+		fp := fieldPath(path, fieldName)
+		fieldMap, ok := fieldValue.(map[string]interface{})
+		if !ok {
+			d.fail(fp, "", elemType, ErrMalformed)
+			continue
+		}
+
+		for k, fv := range fieldMap {
+			Debug.Msgf("fillMap: field %s: %s = %v: ", fieldName, k, fv)
+			v, ok := d.interfaceValue(fp, k, fv)
+			if !ok || v == nil {
+				continue
+			}
+
+			rv := reflect.ValueOf(v)
+			if !rv.Type().AssignableTo(elemType) {
+				d.mismatch(fp, k, elemType)
+				continue
+			}
+			sv.SetMapIndex(reflect.ValueOf(fieldName).Convert(sv.Type().Key()), rv)
+		}
+	}
+}
+
+// interfaceValue converts a Firestore value to the Go value stored in a map[string]interface{} or []interface{}
+// returns false if the value failed to decode
+//
+//	stringValue, booleanValue, integerValue = as provided
+//	doubleValue = float64, including NaN & Infinity
+//	bytesValue = []byte
+//	timestampValue = time.Time
+//	geoPointValue = GeoPoint
+//	arrayValue = []interface{}
+//	mapValue = map[string]interface{}
+//	referenceValue = DocumentRef
+//	nullValue = nil
+func (d *fieldDecoder) interfaceValue(path, k string, fv interface{}) (interface{}, bool) {
+	n := len(d.errs)
+
+	switch k {
+	case "stringValue", "booleanValue", "integerValue":
+		return fv, true
+	case "doubleValue":
+		if x, ok := fv.(string); ok {
+			// NaN & Infinity are received as strings
+			f, err := parseDouble(x)
+			if err != nil {
+				d.fail(path, k, reflect.TypeOf(f), err)
+				return nil, false
+			}
+			return f, true
+		}
+		return fv, true
+	case "bytesValue":
+		b := []byte{}
+		d.setField(path, k, fv, reflect.ValueOf(&b).Elem())
+		return b, len(d.errs) == n
+	case "nullValue":
+		return nil, true
+	case "referenceValue":
+		ref := DocumentRef{}
+		d.setField(path, k, fv, reflect.ValueOf(&ref).Elem())
+		return ref, len(d.errs) == n
+	case "timestampValue":
+		t := time.Time{}
+		d.setField(path, k, fv, reflect.ValueOf(&t).Elem())
+		return t, len(d.errs) == n
+	case "geoPointValue":
+		g := GeoPoint{}
+		d.setField(path, k, fv, reflect.ValueOf(&g).Elem())
+		return g, len(d.errs) == n
+	case "arrayValue":
+		s := []interface{}{}
+		d.setField(path, k, fv, reflect.ValueOf(&s).Elem())
+		return s, len(d.errs) == n
+	case "mapValue":
+		mp := map[string]interface{}{}
+		d.setField(path, k, fv, reflect.ValueOf(&mp).Elem())
+		return mp, len(d.errs) == n
+	}
+
+	d.mismatch(path, k, reflect.TypeOf((*interface{})(nil)).Elem())
+	return nil, false
+}
+
+// fillSlice fills a slice or a fixed size array with the values of an arrayValue
+// slices are allocated to the number of values, values that exceed the length of an array are dropped
+func (d *fieldDecoder) fillSlice(path string, values []interface{}, sv reflect.Value) {
+	Debug.Msgf("fillSlice: field %s: Kind=%s SET(%v) VALID(%v)", sv.Type(), sv.Kind(), sv.CanSet(), sv.IsValid())
+	Debug.Msgf("fillSlice: values: %v", values)
+	if !sv.IsValid() || !sv.CanSet() {
+		return
+	}
+
+	n := len(values)
+	switch sv.Kind() {
+	case reflect.Slice:
+		sv.Set(reflect.MakeSlice(sv.Type(), n, n))
+	case reflect.Array:
+		if n > sv.Len() {
+			Debug.Msgf("fillSlice: %d values exceed the length of %s", n, sv.Type())
+			d.mismatch(path, "arrayValue", sv.Type())
+			n = sv.Len()
+		}
+		// reset any values from a previous fill
+		sv.Set(reflect.Zero(sv.Type()))
+	default:
+		d.mismatch(path, "arrayValue", sv.Type())
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		ip := fmt.Sprintf("%s[%d]", path, i)
+		valueMap, ok := values[i].(map[string]interface{})
+		if !ok {
+			d.fail(ip, "", sv.Type().Elem(), ErrMalformed)
+			continue
+		}
+		for k, fv := range valueMap {
+			d.setField(ip, k, fv, sv.Index(i))
+		}
+	}
+}
+
+// geoPointFields converts a geoPointValue to typed fields, so that it can be filled with fillStruct
+// the latitude & longitude of a geoPointValue are plain numbers: {"latitude": 50.55, "longitude": -104.87}
+func geoPointFields(geo map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, len(geo))
+	for k, v := range geo {
+		fields[k] = map[string]interface{}{"doubleValue": v}
+	}
+	return fields
+}
+
+// wireType returns the Firestore value type of a field: {"stringValue": "..."} = "stringValue"
+func wireType(fieldValue interface{}) string {
+	if m, ok := fieldValue.(map[string]interface{}); ok {
+		for k := range m {
+			return k
+		}
+	}
+	return ""
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	documentRefType = reflect.TypeOf(DocumentRef{})
+	scannerType     = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// fieldScanner returns the sql.Scanner implemented by a pointer to the field: sql.NullString, sql.NullInt64...
+func fieldScanner(dataField reflect.Value) (sql.Scanner, bool) {
+	if !dataField.CanAddr() || !dataField.Addr().Type().Implements(scannerType) {
+		return nil, false
+	}
+	return dataField.Addr().Interface().(sql.Scanner), true
+}
+
+func (d *fieldDecoder) setField(path, k string, fv interface{}, dataField reflect.Value) {
+	// switch case on the fieldType and check the following:
+	// 		stringValue, integerValue, booleanValue, doubleValue, nullValue, referenceValue
+	// 		timestampValue, geoPointValue, arrayValue, mapValue, bytesValue
+	if !dataField.CanSet() {
+		return
+	}
+
+	if dataField.Kind() == reflect.Ptr {
+		if k == "nullValue" {
+			dataField.Set(reflect.Zero(dataField.Type()))
+			return
+		}
+		// allocate nil pointers on demand
+		if dataField.IsNil() {
+			dataField.Set(reflect.New(dataField.Type().Elem()))
+		}
+		d.setField(path, k, fv, dataField.Elem())
+		return
+	}
+
+	if dataField.CanAddr() {
+		switch u := dataField.Addr().Interface().(type) {
+		case FirestoreUnmarshaler:
+			if err := u.UnmarshalFirestore(k, fv); err != nil {
+				d.fail(path, k, dataField.Type(), err)
+			}
+			return
+		case encoding.TextUnmarshaler:
+			if fvs, ok := fv.(string); ok && k == "stringValue" {
+				if err := u.UnmarshalText([]byte(fvs)); err != nil {
+					d.fail(path, k, dataField.Type(), err)
+				}
+				return
+			}
+		}
+	}
+
+	if k == "nullValue" {
+		// null is the zero value of the field: nil for slices & maps, or Valid=false for sql.Null* wrappers
+		if scanner, ok := fieldScanner(dataField); ok {
+			if err := scanner.Scan(nil); err != nil {
+				d.fail(path, k, dataField.Type(), err)
+			}
+			return
+		}
+		dataField.Set(reflect.Zero(dataField.Type()))
+		return
+	}
+
+	if scanner, ok := fieldScanner(dataField); ok {
+		// sql.Scanner receives the value converted as for an interface{} field, with integers as int64
+		v, ok := d.interfaceValue(path, k, fv)
+		if !ok {
+			return
+		}
+		if k == "integerValue" {
+			v = castInteger(v)
+			if s, ok := v.(string); ok {
+				n, err := strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					d.fail(path, k, dataField.Type(), err)
+					return
+				}
+				v = n
+			}
+		}
+		if err := scanner.Scan(v); err != nil {
+			d.fail(path, k, dataField.Type(), err)
+		}
+		return
+	}
+
+	if dataField.Kind() == reflect.Interface {
+		// interface{} fields hold the same values as map[string]interface{}
+		v, ok := d.interfaceValue(path, k, fv)
+		if !ok || v == nil {
+			return
+		}
+		if reflect.TypeOf(v).AssignableTo(dataField.Type()) {
+			dataField.Set(reflect.ValueOf(v))
+		} else {
+			d.mismatch(path, k, dataField.Type())
+		}
+		return
+	}
+
+	switch k {
+	case "referenceValue":
+		fvr, ok := fv.(string)
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		switch {
+		case dataField.Type() == documentRefType:
+			ref, err := ParseDocumentRef(fvr)
+			if err != nil {
+				d.fail(path, k, dataField.Type(), err)
+				return
+			}
+			dataField.Set(reflect.ValueOf(ref))
+		case dataField.Kind() == reflect.String:
+			dataField.SetString(fvr)
+		default:
+			d.mismatch(path, k, dataField.Type())
+		}
+
+	case "stringValue":
+		fvs, ok := fv.(string)
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		if dataField.Kind() != reflect.String {
+			d.mismatch(path, k, dataField.Type())
+			return
+		}
+		dataField.SetString(fvs)
+
+	case "integerValue", "doubleValue":
+		switch x := castInteger(fv).(type) {
+		case int64:
+			d.setInt(path, k, x, dataField)
+		case float64:
+			d.setFloat(path, k, x, dataField)
+		case string:
+			if k == "integerValue" {
+				// integers are encoded as strings to avoid the precision loss of JSON numbers
+				a, err := strconv.ParseInt(x, 10, 64)
+				if err != nil {
+					d.fail(path, k, dataField.Type(), err)
+					return
+				}
+				d.setInt(path, k, a, dataField)
+				return
+			}
+
+			a, err := parseDouble(x)
+			if err != nil {
+				d.fail(path, k, dataField.Type(), err)
+				return
+			}
+			d.setFloat(path, k, a, dataField)
+		default:
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+		}
+
+	case "bytesValue":
+		fvb, ok := fv.(string)
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		if dataField.Kind() != reflect.Slice || dataField.Type().Elem().Kind() != reflect.Uint8 {
+			d.mismatch(path, k, dataField.Type())
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(fvb)
+		if err != nil {
+			d.fail(path, k, dataField.Type(), err)
+			return
+		}
+		dataField.SetBytes(b)
+
+	case "booleanValue":
+		fvb, ok := fv.(bool)
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		if dataField.Kind() != reflect.Bool {
+			d.mismatch(path, k, dataField.Type())
+			return
+		}
+		dataField.SetBool(fvb)
+
+	case "timestampValue":
+		fvt, ok := fv.(string)
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		if dataField.Type() != timeType {
+			d.mismatch(path, k, dataField.Type())
+			return
+		}
+		t, err := time.Parse(time.RFC3339, fvt)
+		if err != nil {
+			d.fail(path, k, dataField.Type(), err)
+			return
+		}
+		dataField.Set(reflect.ValueOf(t))
+
+	case "geoPointValue":
+		// geopoint is a struct with two fields: latitude and longitude
+		// the fields are matched by their fx tags, see GeoPoint
+		gvt, ok := fv.(map[string]interface{})
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		if dataField.Kind() != reflect.Struct {
+			d.mismatch(path, k, dataField.Type())
+			return
+		}
+		d.fillStruct(path, geoPointFields(gvt), dataField)
+
+	// if the field is an array or map, recurse
+	case "arrayValue":
+		avt, ok := fv.(map[string]interface{})
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		// an empty array has no values
+		values, _ := avt["values"].([]interface{})
+		d.fillSlice(path, values, dataField)
+
+	case "mapValue":
+		// get the underlying map which contains the "fields" map
+		mvt, ok := fv.(map[string]interface{})
+		if !ok {
+			d.fail(path, k, dataField.Type(), ErrMalformed)
+			return
+		}
+		// an empty map has no fields
+		mvtFields, _ := mvt["fields"].(map[string]interface{})
+
+		// check the type underlying the struct field
+		switch dataField.Kind() {
+		case reflect.Map:
+			d.fillMap(path, mvtFields, dataField)
+		case reflect.Struct:
+			d.fillStruct(path, mvtFields, dataField)
+		default:
+			d.mismatch(path, k, dataField.Type())
+		}
+
+	default:
+		d.mismatch(path, k, dataField.Type())
+	}
+}
+
+// parseDouble parses a doubleValue that was received as a string, the special values are "NaN", "Infinity" & "-Infinity"
+func parseDouble(s string) (float64, error) {
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		// only the JSON representation of the special values is accepted
+		return 0, fmt.Errorf("invalid doubleValue: %q", s)
+	}
+	return f, nil
+}
+
+// setInt stores an integer in a number field
+func (d *fieldDecoder) setInt(path, k string, x int64, dataField reflect.Value) {
+	switch dataField.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if dataField.OverflowInt(x) {
+			d.fail(path, k, dataField.Type(), ErrOverflow)
+			return
+		}
+		dataField.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if x < 0 || dataField.OverflowUint(uint64(x)) {
+			d.fail(path, k, dataField.Type(), ErrOverflow)
+			return
+		}
+		dataField.SetUint(uint64(x))
+	case reflect.Float32, reflect.Float64:
+		dataField.SetFloat(float64(x))
+	default:
+		d.mismatch(path, k, dataField.Type())
+	}
+}
+
+// setFloat stores a double in a number field, doubles with a fraction are truncated for integer fields
+// NaN & Infinity can only be stored in float fields
+func (d *fieldDecoder) setFloat(path, k string, x float64, dataField reflect.Value) {
+	switch dataField.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if x != math.Trunc(x) && !math.IsNaN(x) && !math.IsInf(x, 0) {
+			d.mismatch(path, k, dataField.Type())
+		}
+		if math.IsNaN(x) || x < math.MinInt64 || x >= math.MaxInt64 || dataField.OverflowInt(int64(x)) {
+			d.fail(path, k, dataField.Type(), ErrOverflow)
+			return
+		}
+		dataField.SetInt(int64(x))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if x != math.Trunc(x) && !math.IsNaN(x) && !math.IsInf(x, 0) {
+			d.mismatch(path, k, dataField.Type())
+		}
+		if math.IsNaN(x) || x < 0 || x >= math.MaxUint64 || dataField.OverflowUint(uint64(x)) {
+			d.fail(path, k, dataField.Type(), ErrOverflow)
+			return
+		}
+		dataField.SetUint(uint64(x))
+	case reflect.Float32, reflect.Float64:
+		if dataField.OverflowFloat(x) {
+			d.fail(path, k, dataField.Type(), ErrOverflow)
+			return
+		}
+		dataField.SetFloat(x)
+	default:
+		d.mismatch(path, k, dataField.Type())
+	}
+}
+
+func castInteger(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return int64(n)
+	case float32:
+		return float64(n)
+	case float64:
+		return float64(n)
+	case string:
+		return n
+	}
+	return nil
+}
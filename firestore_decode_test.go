@@ -0,0 +1,597 @@
+package register
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestFirestoreTagged struct {
+	Name     string   `fx:"name"`
+	Email    string   `fx:"email,required"`
+	Secret   string   `fx:"-"`
+	Location GeoPoint `fx:"location"`
+	Home     struct {
+		Lat float64 `fx:"latitude"`
+		Lng float64 `fx:"longitude"`
+	} `fx:"home"`
+	Count int `fx:",required"`
+}
+
+type TestFirestoreArrays struct {
+	Tags   []string
+	Counts [3]int
+	Times  []time.Time
+	Lines  []struct {
+		SKU string  `fx:"sku"`
+		Qty float64 `fx:"qty"`
+	}
+	Nested [][]string
+	Maps   []map[string]interface{}
+	Any    []interface{}
+	Empty  []string
+	M      map[string]interface{}
+}
+
+type TestFirestoreErrors struct {
+	Small int8
+	When  time.Time
+	Count int
+	Tags  []string
+	Name  string
+}
+
+type TestFirestoreNulls struct {
+	Owner     DocumentRef `fx:"owner"`
+	OwnerPath string      `fx:"ownerPath"`
+	Nick      *string     `fx:"nick"`
+	Home      *GeoPoint   `fx:"home"`
+	Name      string      `fx:"name"`
+	Tags      []string    `fx:"tags"`
+	Email     sql.NullString
+	Visits    sql.NullInt64
+	Score     sql.NullFloat64
+	Seen      sql.NullTime
+	M         map[string]interface{}
+}
+
+type TestFirestoreNumbers struct {
+	Hash    []byte
+	Counter uint32
+	Big     uint64
+	Ratio   float64
+	Inf     float64
+	NegInf  float32
+	M       map[string]interface{}
+}
+
+// TestFirestoreMoney is an amount in cents, decoded from an integerValue or a "12.34" stringValue
+type TestFirestoreMoney int64
+
+func (m *TestFirestoreMoney) UnmarshalFirestore(wireType string, raw interface{}) error {
+	switch wireType {
+	case "nullValue":
+		*m = 0
+		return nil
+	case "integerValue":
+		s, _ := raw.(string)
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		*m = TestFirestoreMoney(i)
+	case "stringValue":
+		s, _ := raw.(string)
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*m = TestFirestoreMoney(math.Round(f * 100))
+	default:
+		return fmt.Errorf("unexpected %s for money", wireType)
+	}
+	if *m < 0 {
+		return fmt.Errorf("negative amount: %d", *m)
+	}
+	return nil
+}
+
+func (m TestFirestoreMoney) MarshalFirestore() (string, interface{}, error) {
+	if m < 0 {
+		return "integerValue", nil, fmt.Errorf("negative amount: %d", m)
+	}
+	return "integerValue", strconv.FormatInt(int64(m), 10), nil
+}
+
+// TestFirestoreStatus is an enum decoded from its name with encoding.TextUnmarshaler
+type TestFirestoreStatus int
+
+var testFirestoreStatuses = []string{"unknown", "open", "closed"}
+
+func (s *TestFirestoreStatus) UnmarshalText(text []byte) error {
+	for i, name := range testFirestoreStatuses {
+		if name == string(text) {
+			*s = TestFirestoreStatus(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid status: %q", text)
+}
+
+func (s TestFirestoreStatus) MarshalText() ([]byte, error) {
+	return []byte(testFirestoreStatuses[s]), nil
+}
+
+type TestFirestoreCustom struct {
+	Price    TestFirestoreMoney    `fx:"price"`
+	Discount *TestFirestoreMoney   `fx:"discount"`
+	Prices   []TestFirestoreMoney  `fx:"prices"`
+	Status   TestFirestoreStatus   `fx:"status"`
+	History  []TestFirestoreStatus `fx:"history"`
+}
+
+type TestFirestoreBase struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"createdAt"`
+	Name    string    `json:"name"`
+}
+
+type TestFirestoreAudit struct {
+	UpdatedBy string `fx:"updatedBy"`
+	Name      string `fx:"auditName"`
+}
+
+type TestFirestoreEmbedded struct {
+	TestFirestoreBase
+	*TestFirestoreAudit
+	Name     string `fx:"name"`
+	Email    string `json:"email,omitempty"`
+	Skipped  string `json:"-"`
+	Age      int
+	Location *GeoPoint           `json:"geo"`
+	Line     *TestFirestoreLine  `json:"line"`
+	Base     TestFirestoreBase   `json:"base"`
+	Audit    *TestFirestoreAudit `fx:"audit"`
+}
+
+func TestFirestoreDecode(t *testing.T) {
+	fields := func(t *testing.T, s string) map[string]interface{} {
+		m := map[string]interface{}{}
+		err := json.Unmarshal([]byte(s), &m)
+		if err != nil {
+			t.Fatalf("Error unmarshalling test firestore fields: %v", err)
+		}
+		return m
+	}
+
+	t.Run("Tagged Fields", func(t *testing.T) {
+		m := fields(t, `{
+			"name": {"stringValue": "Jane"},
+			"email": {"stringValue": "jane@example.com"},
+			"Secret": {"stringValue": "hunter2"},
+			"-": {"stringValue": "hunter2"},
+			"location": {"geoPointValue": {"latitude": 50.55, "longitude": -104.87}},
+			"home": {"geoPointValue": {"latitude": -33.86, "longitude": 151.21}},
+			"Count": {"integerValue": "3"}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreTagged{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreTagged{}, v) {
+			d := v.(*TestFirestoreTagged)
+			assert.Equal(t, "Jane", d.Name, "Name should be decoded from the name field")
+			assert.Equal(t, "jane@example.com", d.Email, "Email should be decoded from the email field")
+			assert.Equal(t, "", d.Secret, "Secret should be skipped")
+			assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, d.Location, "Location should be decoded from the location field")
+			assert.Equal(t, -33.86, d.Home.Lat, "Home.Lat should be decoded from the latitude")
+			assert.Equal(t, 151.21, d.Home.Lng, "Home.Lng should be decoded from the longitude")
+			assert.Equal(t, 3, d.Count, "Count should be decoded from the Count field")
+		}
+	})
+
+	t.Run("Required", func(t *testing.T) {
+		m := fields(t, `{
+			"name": {"stringValue": "Jane"},
+			"Count": {"integerValue": "3"}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreTagged{})
+		assert.NotNil(t, err, "Error should be returned when a required field is missing")
+		assert.Nil(t, v, "Value should be nil when a required field is missing")
+	})
+
+	t.Run("GeoPoint Map", func(t *testing.T) {
+		m := fields(t, `{
+			"M": {"mapValue": {"fields": {
+				"geo": {"geoPointValue": {"latitude": 50.55, "longitude": -104.87}}
+			}}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreI{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreI{}, v) {
+			assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, v.(*TestFirestoreI).M["geo"], "geo should be decoded as a GeoPoint")
+		}
+	})
+
+	t.Run("Arrays", func(t *testing.T) {
+		m := fields(t, `{
+			"Tags": {"arrayValue": {"values": [{"stringValue": "a"}, {"stringValue": "b"}]}},
+			"Counts": {"arrayValue": {"values": [{"integerValue": "1"}, {"integerValue": "2"}, {"integerValue": "3"}, {"integerValue": "4"}]}},
+			"Times": {"arrayValue": {"values": [{"timestampValue": "2022-01-02T22:19:55Z"}]}},
+			"Lines": {"arrayValue": {"values": [
+				{"mapValue": {"fields": {"sku": {"stringValue": "X1"}, "qty": {"integerValue": "2"}}}},
+				{"mapValue": {"fields": {"sku": {"stringValue": "Y2"}, "qty": {"doubleValue": 0.5}}}}
+			]}},
+			"Nested": {"arrayValue": {"values": [
+				{"arrayValue": {"values": [{"stringValue": "a"}]}},
+				{"arrayValue": {"values": [{"stringValue": "b"}, {"stringValue": "c"}]}}
+			]}},
+			"Maps": {"arrayValue": {"values": [{"mapValue": {"fields": {"k": {"booleanValue": true}}}}]}},
+			"Any": {"arrayValue": {"values": [{"stringValue": "a"}, {"booleanValue": true}, {"arrayValue": {"values": [{"doubleValue": 1.5}]}}]}},
+			"Empty": {"arrayValue": {}},
+			"M": {"mapValue": {"fields": {"list": {"arrayValue": {"values": [{"stringValue": "a"}, {"mapValue": {"fields": {"b": {"stringValue": "c"}}}}]}}}}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreArrays{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreArrays{}, v) {
+			d := v.(*TestFirestoreArrays)
+			assert.Equal(t, []string{"a", "b"}, d.Tags, "Tags should be decoded")
+			assert.Equal(t, [3]int{1, 2, 3}, d.Counts, "Counts should be decoded up to the array length")
+			assert.Equal(t, []time.Time{time.Date(2022, 1, 2, 22, 19, 55, 0, time.UTC)}, d.Times, "Times should be decoded")
+			if assert.Len(t, d.Lines, 2, "Lines should be decoded") {
+				assert.Equal(t, "X1", d.Lines[0].SKU, "Lines[0].SKU should be decoded")
+				assert.Equal(t, float64(2), d.Lines[0].Qty, "Lines[0].Qty should be decoded")
+				assert.Equal(t, "Y2", d.Lines[1].SKU, "Lines[1].SKU should be decoded")
+				assert.Equal(t, 0.5, d.Lines[1].Qty, "Lines[1].Qty should be decoded")
+			}
+			assert.Equal(t, [][]string{{"a"}, {"b", "c"}}, d.Nested, "Nested should be decoded")
+			assert.Equal(t, []map[string]interface{}{{"k": true}}, d.Maps, "Maps should be decoded")
+			assert.Equal(t, []interface{}{"a", true, []interface{}{1.5}}, d.Any, "Any should be decoded")
+			assert.Equal(t, []string{}, d.Empty, "Empty should be decoded as an empty slice")
+			assert.Equal(t, []interface{}{"a", map[string]interface{}{"b": "c"}}, d.M["list"], "arrays within maps should be decoded as []interface{}")
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		m := fields(t, `{
+			"Small": {"integerValue": "300"},
+			"When": {"timestampValue": "yesterday"},
+			"Count": {"integerValue": "12a"},
+			"Tags": {"arrayValue": {"values": ["a"]}},
+			"Name": "Jane",
+			"Unknown": {"stringValue": "skipped"}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreErrors{})
+		assert.Nil(t, v, "Value should be nil when fields fail to decode")
+
+		var de *DecodeError
+		if assert.True(t, errors.As(err, &de), "Error should be a *DecodeError") {
+			paths := map[string]*FieldError{}
+			for _, fe := range de.Errors {
+				paths[fe.Path] = fe
+			}
+			assert.Len(t, paths, 5, "Unknown fields should be skipped: %s", err)
+
+			if assert.Contains(t, paths, "Small") {
+				assert.Equal(t, "integerValue", paths["Small"].WireType, "WireType should be integerValue")
+				assert.Equal(t, "int8", paths["Small"].GoType, "GoType should be int8")
+				assert.True(t, errors.Is(paths["Small"], ErrOverflow), "Small should overflow")
+			}
+			if assert.Contains(t, paths, "When") {
+				assert.Equal(t, "time.Time", paths["When"].GoType, "GoType should be time.Time")
+			}
+			assert.Contains(t, paths, "Count", "Count should fail to parse")
+			if assert.Contains(t, paths, "Tags[0]") {
+				assert.True(t, errors.Is(paths["Tags[0]"], ErrMalformed), "Tags[0] should be malformed")
+			}
+			if assert.Contains(t, paths, "Name") {
+				assert.True(t, errors.Is(paths["Name"], ErrMalformed), "Name should be malformed")
+			}
+		}
+		assert.True(t, errors.Is(err, ErrOverflow), "errors.Is should match the field errors")
+		assert.False(t, errors.Is(err, ErrUnknownField), "Unknown fields should not be reported")
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		reg := NewRegister()
+		called := 0
+		fn := func(ctx context.Context, e FirestoreEvent) error {
+			called++
+			return nil
+		}
+		reg.Firestore().Collection("strict").Document("{id}").Strict().Update(TestFirestoreErrors{}, fn)
+		reg.Firestore().Collection("loose").Document("{id}").Update(TestFirestoreErrors{}, fn)
+
+		dec := &Decoder{data: []byte(`{
+			"oldValue": {"fields": {"Name": {"stringValue": "Jane"}}},
+			"value": {"fields": {"Name": {"integerValue": "1"}, "Other": {"stringValue": "x"}}}
+		}`)}
+		ctx := func(coll string) context.Context {
+			return metadata.NewContext(context.Background(), &metadata.Metadata{
+				EventType: string(FirestoreDocumentUpdateEvent),
+				Resource: &metadata.Resource{
+					RawPath: "projects/[project-name]/databases/(default)/documents/" + coll + "/1",
+				},
+			})
+		}
+
+		err := reg.EntryPoint(ctx("loose"), dec)
+		assert.Nil(t, err, "Error should be nil without strict mode")
+		assert.Equal(t, 1, called, "Function should be called without strict mode")
+
+		err = reg.EntryPoint(ctx("strict"), dec)
+		assert.Equal(t, 1, called, "Function should not be called in strict mode")
+		assert.True(t, errors.Is(err, ErrTypeMismatch), "Name should be a type mismatch")
+		assert.True(t, errors.Is(err, ErrUnknownField), "Other should be an unknown field")
+
+		var de *DecodeError
+		if assert.True(t, errors.As(err, &de), "Error should be a *DecodeError") {
+			paths := []string{}
+			for _, fe := range de.Errors {
+				paths = append(paths, fe.Path)
+			}
+			assert.ElementsMatch(t, []string{"value.Name", "value.Other"}, paths, "Paths should include the value")
+		}
+	})
+
+	t.Run("Missing Value", func(t *testing.T) {
+		reg := NewRegister()
+		var evt FirestoreEvent
+		fn := func(ctx context.Context, e FirestoreEvent) error {
+			evt = e
+			return nil
+		}
+		reg.Firestore().Collection("users").Document("{id}").Create(TestFirestoreErrors{}, fn)
+
+		err := reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+			EventType: string(FirestoreDocumentCreateEvent),
+			Resource: &metadata.Resource{
+				RawPath: "projects/[project-name]/databases/(default)/documents/users/1",
+			},
+		}), &Decoder{data: []byte(`{"oldValue": {}, "value": {"fields": {"Name": {"stringValue": "Jane"}}}}`)})
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, evt.OldValue.Fields, "OldValue.Fields should be nil for a created document")
+		if assert.IsType(t, &TestFirestoreErrors{}, evt.Value.Fields) {
+			assert.Equal(t, "Jane", evt.Value.Fields.(*TestFirestoreErrors).Name, "Name should be decoded")
+		}
+	})
+
+	t.Run("References & Nulls", func(t *testing.T) {
+		m := fields(t, `{
+			"owner": {"referenceValue": "projects/p/databases/(default)/documents/users/1"},
+			"ownerPath": {"referenceValue": "projects/p/databases/(default)/documents/users/1"},
+			"nick": {"stringValue": "jj"},
+			"home": {"geoPointValue": {"latitude": 50.55, "longitude": -104.87}},
+			"name": {"nullValue": null},
+			"tags": {"nullValue": null},
+			"Email": {"stringValue": "jane@example.com"},
+			"Visits": {"integerValue": "42"},
+			"Score": {"nullValue": null},
+			"Seen": {"timestampValue": "2022-01-02T22:19:55Z"},
+			"M": {"mapValue": {"fields": {"ref": {"referenceValue": "projects/p/databases/(default)/documents/users/2"}}}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreNulls{Name: "ignored"})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreNulls{}, v) {
+			d := v.(*TestFirestoreNulls)
+			assert.Equal(t, DocumentRef{Project: "p", Database: "(default)", Path: "users/1"}, d.Owner, "Owner should be a DocumentRef")
+			assert.Equal(t, "projects/p/databases/(default)/documents/users/1", d.OwnerPath, "OwnerPath should be the reference name")
+			if assert.NotNil(t, d.Nick, "Nick should be allocated") {
+				assert.Equal(t, "jj", *d.Nick, "Nick should be decoded")
+			}
+			if assert.NotNil(t, d.Home, "Home should be allocated") {
+				assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, *d.Home, "Home should be decoded")
+			}
+			assert.Equal(t, "", d.Name, "Name should be zero")
+			assert.Nil(t, d.Tags, "Tags should be nil")
+			assert.Equal(t, sql.NullString{String: "jane@example.com", Valid: true}, d.Email, "Email should be scanned")
+			assert.Equal(t, sql.NullInt64{Int64: 42, Valid: true}, d.Visits, "Visits should be scanned")
+			assert.Equal(t, sql.NullFloat64{}, d.Score, "Score should not be valid")
+			assert.Equal(t, sql.NullTime{Time: time.Date(2022, 1, 2, 22, 19, 55, 0, time.UTC), Valid: true}, d.Seen, "Seen should be scanned")
+			assert.Equal(t, DocumentRef{Project: "p", Database: "(default)", Path: "users/2"}, d.M["ref"], "references within maps should be a DocumentRef")
+		}
+	})
+
+	t.Run("Null Pointers", func(t *testing.T) {
+		d := &fieldDecoder{}
+		nick := "jj"
+		v := TestFirestoreNulls{Nick: &nick, Home: &GeoPoint{}, Email: sql.NullString{String: "x", Valid: true}}
+		d.fillStruct("", fields(t, `{
+			"nick": {"nullValue": null},
+			"home": {"nullValue": null},
+			"Email": {"nullValue": null}
+		}`), reflect.ValueOf(&v).Elem())
+
+		assert.Nil(t, d.err(), "Error should be nil")
+		assert.Nil(t, v.Nick, "Nick should be set to nil")
+		assert.Nil(t, v.Home, "Home should be set to nil")
+		assert.Equal(t, sql.NullString{}, v.Email, "Email should not be valid")
+	})
+
+	t.Run("Invalid Reference", func(t *testing.T) {
+		_, err := copyFields(fields(t, `{"owner": {"referenceValue": "users/1"}}`), &TestFirestoreNulls{})
+		var de *DecodeError
+		if assert.True(t, errors.As(err, &de), "Error should be a *DecodeError") {
+			assert.Equal(t, "owner", de.Errors[0].Path, "Path should be owner")
+			assert.Equal(t, "register.DocumentRef", de.Errors[0].GoType, "GoType should be DocumentRef")
+		}
+	})
+
+	t.Run("Bytes & Numbers", func(t *testing.T) {
+		m := fields(t, `{
+			"Hash": {"bytesValue": "3q2+7w=="},
+			"Counter": {"integerValue": "4294967295"},
+			"Big": {"doubleValue": 1e10},
+			"Ratio": {"doubleValue": "NaN"},
+			"Inf": {"doubleValue": "Infinity"},
+			"NegInf": {"doubleValue": "-Infinity"},
+			"M": {"mapValue": {"fields": {"b": {"bytesValue": "AQI="}, "nan": {"doubleValue": "NaN"}}}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreNumbers{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreNumbers{}, v) {
+			d := v.(*TestFirestoreNumbers)
+			assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, d.Hash, "Hash should be decoded from base64")
+			assert.Equal(t, uint32(math.MaxUint32), d.Counter, "Counter should be decoded")
+			assert.Equal(t, uint64(1e10), d.Big, "Big should be decoded")
+			assert.True(t, math.IsNaN(d.Ratio), "Ratio should be NaN")
+			assert.True(t, math.IsInf(d.Inf, 1), "Inf should be +Inf")
+			assert.True(t, math.IsInf(float64(d.NegInf), -1), "NegInf should be -Inf")
+			assert.Equal(t, []byte{1, 2}, d.M["b"], "bytes within maps should be []byte")
+			if f, ok := d.M["nan"].(float64); assert.True(t, ok, "NaN within maps should be a float64") {
+				assert.True(t, math.IsNaN(f), "nan should be NaN")
+			}
+		}
+	})
+
+	t.Run("Numeric Errors", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			json string
+			err  error
+		}{
+			"Negative Unsigned": {`{"Counter": {"integerValue": "-1"}}`, ErrOverflow},
+			"Unsigned Overflow": {`{"Counter": {"integerValue": "4294967296"}}`, ErrOverflow},
+			"Double Overflow":   {`{"Big": {"doubleValue": -1}}`, ErrOverflow},
+			"NaN Unsigned":      {`{"Counter": {"doubleValue": "NaN"}}`, ErrOverflow},
+			"Invalid Double":    {`{"Ratio": {"doubleValue": "inf"}}`, nil},
+			"Invalid Integer":   {`{"Counter": {"integerValue": "1.5"}}`, nil},
+			"Invalid Bytes":     {`{"Hash": {"bytesValue": "not base64"}}`, nil},
+		} {
+			_, err := copyFields(fields(t, tt.json), &TestFirestoreNumbers{})
+			var de *DecodeError
+			if assert.True(t, errors.As(err, &de), "%s: Error should be a *DecodeError", name) && tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "%s: Error should be %s: %s", name, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("Custom Types", func(t *testing.T) {
+		m := fields(t, `{
+			"price": {"stringValue": "12.34"},
+			"discount": {"integerValue": "150"},
+			"prices": {"arrayValue": {"values": [{"integerValue": "1"}, {"stringValue": "0.02"}, {"nullValue": null}]}},
+			"status": {"stringValue": "closed"},
+			"history": {"arrayValue": {"values": [{"stringValue": "open"}, {"stringValue": "closed"}]}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreCustom{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreCustom{}, v) {
+			d := v.(*TestFirestoreCustom)
+			assert.Equal(t, TestFirestoreMoney(1234), d.Price, "Price should be decoded by UnmarshalFirestore")
+			if assert.NotNil(t, d.Discount, "Discount should be allocated") {
+				assert.Equal(t, TestFirestoreMoney(150), *d.Discount, "Discount should be decoded by UnmarshalFirestore")
+			}
+			assert.Equal(t, []TestFirestoreMoney{1, 2, 0}, d.Prices, "Prices should be decoded by UnmarshalFirestore")
+			assert.Equal(t, TestFirestoreStatus(2), d.Status, "Status should be decoded by UnmarshalText")
+			assert.Equal(t, []TestFirestoreStatus{1, 2}, d.History, "History should be decoded by UnmarshalText")
+		}
+
+		encoded, err := MarshalFirestoreFields(v)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, map[string]interface{}{"integerValue": "1234"}, encoded["price"], "price should be encoded by MarshalFirestore")
+		assert.Equal(t, map[string]interface{}{"stringValue": "closed"}, encoded["status"], "status should be encoded by MarshalText")
+	})
+
+	t.Run("Custom Type Errors", func(t *testing.T) {
+		for name, tt := range map[string]struct {
+			json string
+			path string
+		}{
+			"Validation":    {`{"price": {"integerValue": "-5"}}`, "price"},
+			"Wire Type":     {`{"price": {"booleanValue": true}}`, "price"},
+			"Array Element": {`{"prices": {"arrayValue": {"values": [{"integerValue": "1"}, {"stringValue": "abc"}]}}}`, "prices[1]"},
+			"Invalid Text":  {`{"status": {"stringValue": "pending"}}`, "status"},
+		} {
+			_, err := copyFields(fields(t, tt.json), &TestFirestoreCustom{})
+			var de *DecodeError
+			if assert.True(t, errors.As(err, &de), "%s: Error should be a *DecodeError", name) {
+				assert.Equal(t, tt.path, de.Errors[0].Path, "%s: Path should be %s", name, tt.path)
+			}
+		}
+
+		_, err := MarshalFirestoreFields(TestFirestoreCustom{Price: -1})
+		var fe *FieldError
+		if assert.True(t, errors.As(err, &fe), "Error should be a *FieldError") {
+			assert.Equal(t, "price", fe.Path, "Path should be price")
+		}
+	})
+
+	t.Run("Embedded & JSON Tags", func(t *testing.T) {
+		m := fields(t, `{
+			"id": {"stringValue": "abc"},
+			"createdAt": {"timestampValue": "2022-01-02T22:19:55.897215Z"},
+			"name": {"stringValue": "Jane"},
+			"updatedBy": {"stringValue": "admin"},
+			"auditName": {"stringValue": "audit"},
+			"email": {"stringValue": "jane@example.com"},
+			"Skipped": {"stringValue": "x"},
+			"age": {"integerValue": "42"},
+			"geo": {"geoPointValue": {"latitude": 50.55, "longitude": -104.87}},
+			"line": {"mapValue": {"fields": {"sku": {"stringValue": "A1"}}}},
+			"base": {"mapValue": {"fields": {"id": {"stringValue": "nested"}}}},
+			"audit": {"mapValue": {"fields": {"UPDATEDBY": {"stringValue": "root"}}}}
+		}`)
+
+		v, err := copyFields(m, &TestFirestoreEmbedded{})
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestFirestoreEmbedded{}, v) {
+			d := v.(*TestFirestoreEmbedded)
+			assert.Equal(t, "abc", d.ID, "ID should be promoted from the embedded struct")
+			assert.Equal(t, time.Date(2022, 1, 2, 22, 19, 55, 897215000, time.UTC), d.Created, "Created should be named by the json tag")
+			assert.Equal(t, "Jane", d.Name, "name should populate the shallower field")
+			assert.Equal(t, "", d.TestFirestoreBase.Name, "the embedded name should be hidden")
+			if assert.NotNil(t, d.TestFirestoreAudit, "the embedded pointer should be allocated") {
+				assert.Equal(t, "admin", d.UpdatedBy, "UpdatedBy should be promoted from the embedded pointer")
+				assert.Equal(t, "audit", d.TestFirestoreAudit.Name, "auditName should be named by the fx tag")
+			}
+			assert.Equal(t, "jane@example.com", d.Email, "Email should be named by the json tag")
+			assert.Equal(t, "", d.Skipped, "Skipped should not be populated")
+			assert.Equal(t, 42, d.Age, "Age should be matched case-insensitively")
+			if assert.NotNil(t, d.Location, "Location should be allocated") {
+				assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, *d.Location, "Location should be named by the json tag")
+			}
+			if assert.NotNil(t, d.Line, "Line should be allocated") {
+				assert.Equal(t, "A1", d.Line.SKU, "Line should be decoded from the mapValue")
+			}
+			assert.Equal(t, "nested", d.Base.ID, "Base should be decoded from the mapValue")
+			if assert.NotNil(t, d.Audit, "Audit should be allocated") {
+				assert.Equal(t, "root", d.Audit.UpdatedBy, "UPDATEDBY should be matched case-insensitively")
+			}
+		}
+
+		// the exact name takes precedence over a case-insensitive match
+		v, err = (&fieldDecoder{strict: true}).copyFields("", fields(t, `{
+			"Age": {"integerValue": "1"},
+			"AGE": {"integerValue": "2"}
+		}`), &TestFirestoreEmbedded{})
+		var de *DecodeError
+		if assert.True(t, errors.As(err, &de), "Error should be a *DecodeError") {
+			assert.Equal(t, 1, len(de.Errors), "only AGE should be an error")
+			assert.Equal(t, "AGE", de.Errors[0].Path, "Path should be AGE")
+			assert.True(t, errors.Is(err, ErrUnknownField), "AGE should be an unknown field")
+		}
+
+		encoded, err := MarshalFirestoreFields(TestFirestoreEmbedded{TestFirestoreBase: TestFirestoreBase{ID: "abc"}, Email: "jane@example.com"})
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, map[string]interface{}{"stringValue": "abc"}, encoded["id"], "id should be promoted from the embedded struct")
+		assert.Equal(t, map[string]interface{}{"stringValue": "jane@example.com"}, encoded["email"], "email should be named by the json tag")
+		assert.NotContains(t, encoded, "updatedBy", "fields of a nil embedded pointer should not be encoded")
+		assert.NotContains(t, encoded, "Skipped", "Skipped should not be encoded")
+	})
+}
@@ -0,0 +1,284 @@
+package register
+
+import (
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupportedType is returned when a value cannot be represented as a Firestore value
+var ErrUnsupportedType = errors.New("unsupported type")
+
+var (
+	geoPointType = reflect.TypeOf(GeoPoint{})
+	valuerType   = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// FirestoreMarshaler is implemented by types that encode themselves as a Firestore value, the counterpart of FirestoreUnmarshaler
+// wireType is the Firestore value type, raw is the value in the received format: integers are strings, maps are {"fields": {...}}
+//
+// types implementing encoding.TextMarshaler are encoded as a stringValue with MarshalText
+type FirestoreMarshaler interface {
+	MarshalFirestore() (wireType string, raw interface{}, err error)
+}
+
+// MarshalFirestoreFields encodes a struct, or a map with string keys, into the typed fields of a Firestore document
+// as they are received by a FirestoreFunc: {"name": {"stringValue": "Jane"}, "age": {"integerValue": "42"}}
+// The fields are named with the same fx tags used when decoding, string fields tagged `fx:"owner,reference"` are encoded as a referenceValue
+//
+//	string = stringValue
+//	int, uint = integerValue
+//	float = doubleValue
+//	bool = booleanValue
+//	[]byte = bytesValue
+//	time.Time = timestampValue
+//	GeoPoint, struct with only float fields tagged `fx:"latitude"` & `fx:"longitude"` = geoPointValue
+//	DocumentRef = referenceValue
+//	driver.Valuer = the encoded driver.Value, sql.NullString{} = nullValue
+//	FirestoreMarshaler = as returned, encoding.TextMarshaler = stringValue
+//	slice, array = arrayValue
+//	struct, map = mapValue
+//	nil pointer, slice, map or interface = nullValue
+func MarshalFirestoreFields(v interface{}) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, &FieldError{GoType: rv.Type().String(), Err: ErrUnsupportedType}
+		}
+		rv = rv.Elem()
+	}
+
+	switch {
+	case rv.Kind() == reflect.Struct && rv.Type() != timeType && !geoPointStruct(rv.Type()):
+		return encodeStruct("", rv)
+	case rv.Kind() == reflect.Map:
+		return encodeMap("", rv)
+	}
+
+	goType := "<nil>"
+	if rv.IsValid() {
+		goType = rv.Type().String()
+	}
+	return nil, &FieldError{GoType: goType, Err: fmt.Errorf("%w: expected a struct or a map", ErrUnsupportedType)}
+}
+
+func encodeStruct(path string, sv reflect.Value) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	for name, sf := range structFields(sv.Type()) {
+		fp := fieldPath(path, name)
+		fv, ok := fieldByIndex(sv, sf.index, false)
+		if !ok {
+			// the field of a nil embedded pointer
+			continue
+		}
+
+		if sf.reference {
+			if fv.Kind() != reflect.String {
+				return nil, &FieldError{Path: fp, WireType: "referenceValue", GoType: fv.Type().String(), Err: ErrUnsupportedType}
+			}
+			fields[name] = map[string]interface{}{"referenceValue": fv.String()}
+			continue
+		}
+
+		value, err := encodeValue(fp, fv)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+func encodeMap(path string, mv reflect.Value) (map[string]interface{}, error) {
+	if mv.Type().Key().Kind() != reflect.String {
+		return nil, &FieldError{Path: path, WireType: "mapValue", GoType: mv.Type().String(), Err: fmt.Errorf("%w: map keys must be strings", ErrUnsupportedType)}
+	}
+
+	fields := make(map[string]interface{}, mv.Len())
+	iter := mv.MapRange()
+	for iter.Next() {
+		name := iter.Key().String()
+		value, err := encodeValue(fieldPath(path, name), iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+// encodeValue encodes a single value as a typed Firestore value: {"stringValue": "..."}
+func encodeValue(path string, v reflect.Value) (map[string]interface{}, error) {
+	null := map[string]interface{}{"nullValue": nil}
+
+	if v.IsValid() && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		iface := v.Interface()
+		if v.CanAddr() {
+			// the method set of the pointer includes methods with a pointer receiver
+			iface = v.Addr().Interface()
+		}
+
+		switch m := iface.(type) {
+		case FirestoreMarshaler:
+			wireType, raw, err := m.MarshalFirestore()
+			if err != nil {
+				return nil, &FieldError{Path: path, WireType: wireType, GoType: v.Type().String(), Err: err}
+			}
+			return map[string]interface{}{wireType: raw}, nil
+		case encoding.TextMarshaler:
+			if v.Type() == timeType {
+				break
+			}
+			text, err := m.MarshalText()
+			if err != nil {
+				return nil, &FieldError{Path: path, WireType: "stringValue", GoType: v.Type().String(), Err: err}
+			}
+			return map[string]interface{}{"stringValue": string(text)}, nil
+		}
+	}
+
+	if v.IsValid() && v.Type().Implements(valuerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		// sql.Null* wrappers are encoded by their driver.Value, nil is a nullValue
+		dv, err := v.Interface().(driver.Valuer).Value()
+		if err != nil {
+			return nil, &FieldError{Path: path, GoType: v.Type().String(), Err: err}
+		}
+		if dv == nil {
+			return null, nil
+		}
+		return encodeValue(path, reflect.ValueOf(dv))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return null, nil
+		}
+		return encodeValue(path, v.Elem())
+
+	case reflect.String:
+		return map[string]interface{}{"stringValue": v.String()}, nil
+
+	case reflect.Bool:
+		return map[string]interface{}{"booleanValue": v.Bool()}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// integers are encoded as strings to avoid the precision loss of JSON numbers
+		return map[string]interface{}{"integerValue": strconv.FormatInt(v.Int(), 10)}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, &FieldError{Path: path, WireType: "integerValue", GoType: v.Type().String(), Err: ErrOverflow}
+		}
+		return map[string]interface{}{"integerValue": strconv.FormatUint(v.Uint(), 10)}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"doubleValue": protoDouble(v.Float())}, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return null, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"bytesValue": base64.StdEncoding.EncodeToString(v.Bytes())}, nil
+		}
+		return encodeArray(path, v)
+
+	case reflect.Array:
+		return encodeArray(path, v)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return null, nil
+		}
+		fields, err := encodeMap(path, v)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}, nil
+
+	case reflect.Struct:
+		switch v.Type() {
+		case timeType:
+			return map[string]interface{}{"timestampValue": v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)}, nil
+		case documentRefType:
+			ref := v.Interface().(DocumentRef)
+			if ref.IsZero() {
+				return null, nil
+			}
+			return map[string]interface{}{"referenceValue": ref.String()}, nil
+		case geoPointType:
+			g := v.Interface().(GeoPoint)
+			return map[string]interface{}{"geoPointValue": map[string]interface{}{"latitude": g.Latitude, "longitude": g.Longitude}}, nil
+		}
+		if geoPointStruct(v.Type()) {
+			return encodeGeoPoint(v), nil
+		}
+
+		fields, err := encodeStruct(path, v)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}, nil
+	}
+
+	goType := "<nil>"
+	if v.IsValid() {
+		goType = v.Type().String()
+	}
+	return nil, &FieldError{Path: path, GoType: goType, Err: ErrUnsupportedType}
+}
+
+// geoPointStruct reports whether a struct is encoded as a geoPointValue: GeoPoint, or a struct with only
+// float fields tagged `fx:"latitude"` & `fx:"longitude"` as the decoder fills from a geoPointValue
+// structs with other fields are encoded as a mapValue, as their other fields would be lost
+func geoPointStruct(t reflect.Type) bool {
+	if t == geoPointType {
+		return true
+	}
+	fields := structFields(t)
+	if len(fields) != 2 {
+		return false
+	}
+	for _, name := range []string{"latitude", "longitude"} {
+		f, ok := fields[name]
+		if !ok || !f.tagged {
+			return false
+		}
+		if k := t.FieldByIndex(f.index).Type.Kind(); k != reflect.Float64 && k != reflect.Float32 {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeGeoPoint encodes a struct detected by geoPointStruct as a geoPointValue
+func encodeGeoPoint(sv reflect.Value) map[string]interface{} {
+	fields := structFields(sv.Type())
+	geo := map[string]interface{}{}
+	for _, name := range []string{"latitude", "longitude"} {
+		geo[name] = 0.0
+		if fv, ok := fieldByIndex(sv, fields[name].index, false); ok {
+			geo[name] = fv.Float()
+		}
+	}
+	return map[string]interface{}{"geoPointValue": geo}
+}
+
+func encodeArray(path string, v reflect.Value) (map[string]interface{}, error) {
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		value, err := encodeValue(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}, nil
+}
@@ -0,0 +1,206 @@
+package register
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestFirestoreEncoded struct {
+	Name    string  `fx:"name"`
+	Owner   string  `fx:"owner,reference"`
+	Secret  string  `fx:"-"`
+	Count   int     `fx:"count"`
+	Small   int8    `fx:"small"`
+	Ratio   float64 `fx:"ratio"`
+	Single  float32 `fx:"single"`
+	Active  bool
+	Created time.Time           `fx:"createdAt"`
+	Geo     GeoPoint            `fx:"geo"`
+	Pin     TestFirestoreLatLng `fx:"pin"`
+	Tags    []string
+	Counts  [3]int
+	Nested  [][]string
+	Lines   []TestFirestoreLine
+	Address TestFirestoreLine
+	Labels  map[string]string
+	Flags   map[string]bool
+	Any     interface{}
+	Ref     DocumentRef `fx:"ref"`
+	Nick    *string
+	Home    *GeoPoint
+	Parent  *TestFirestoreLine
+	Email   sql.NullString
+	Visits  sql.NullInt64
+	Total   uint64 `fx:"total"`
+	Flags8  uint8
+	Hash    []byte
+}
+
+// TestFirestoreLatLng is decoded from & encoded as a geoPointValue
+type TestFirestoreLatLng struct {
+	Lat float32 `fx:"latitude"`
+	Lng float64 `fx:"longitude"`
+}
+
+type TestFirestoreLine struct {
+	SKU string  `fx:"sku"`
+	Qty float64 `fx:"qty"`
+}
+
+// Generate implements quick.Generator, time.Time has unexported fields that cannot be generated by testing/quick
+func (TestFirestoreEncoded) Generate(r *rand.Rand, size int) reflect.Value {
+	str := func() string {
+		v, _ := quick.Value(reflect.TypeOf(""), r)
+		return v.String()
+	}
+	strs := func() []string {
+		s := make([]string, r.Intn(size+1))
+		for i := range s {
+			s[i] = str()
+		}
+		return s
+	}
+	line := func() TestFirestoreLine {
+		return TestFirestoreLine{SKU: str(), Qty: r.NormFloat64() * 1e6}
+	}
+
+	v := TestFirestoreEncoded{
+		Name:    str(),
+		Owner:   "projects/p/databases/(default)/documents/users/" + str(),
+		Count:   int(r.Int63() - r.Int63()),
+		Small:   int8(r.Intn(256) - 128),
+		Ratio:   r.NormFloat64() * 1e9,
+		Single:  r.Float32(),
+		Active:  r.Intn(2) == 1,
+		Created: time.Unix(r.Int63n(1e10), r.Int63n(1e9)).UTC(),
+		Geo:     GeoPoint{Latitude: r.Float64()*180 - 90, Longitude: r.Float64()*360 - 180},
+		Pin:     TestFirestoreLatLng{Lat: r.Float32()*180 - 90, Lng: r.Float64()*360 - 180},
+		Tags:    strs(),
+		Counts:  [3]int{r.Int(), -r.Int(), 0},
+		Nested:  [][]string{strs(), strs()},
+		Address: line(),
+		Labels:  map[string]string{},
+		Flags:   map[string]bool{},
+		Total:   uint64(r.Int63()),
+		Flags8:  uint8(r.Intn(256)),
+	}
+	if r.Intn(2) == 1 {
+		v.Hash = make([]byte, r.Intn(size+1))
+		r.Read(v.Hash)
+	}
+	for i := r.Intn(size + 1); i > 0; i-- {
+		v.Lines = append(v.Lines, line())
+		v.Labels[str()] = str()
+		v.Flags[str()] = r.Intn(2) == 1
+	}
+	switch r.Intn(3) {
+	case 0:
+		v.Any = str()
+	case 1:
+		v.Any = r.Intn(2) == 1
+	}
+	if r.Intn(2) == 1 {
+		nick, home, parent := str(), v.Geo, line()
+		v.Nick, v.Home, v.Parent = &nick, &home, &parent
+		v.Ref = DocumentRef{Project: "p", Database: "(default)", Path: "users/" + fmt.Sprint(r.Int())}
+		v.Email = sql.NullString{String: str(), Valid: true}
+		v.Visits = sql.NullInt64{Int64: r.Int63(), Valid: true}
+	}
+
+	return reflect.ValueOf(v)
+}
+
+func TestFirestoreEncode(t *testing.T) {
+	// roundTrip encodes v and decodes the fields as they would be received in a FirestoreEvent
+	roundTrip := func(v TestFirestoreEncoded) (*TestFirestoreEncoded, error) {
+		fields, err := MarshalFirestoreFields(v)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		m := map[string]interface{}{}
+		err = json.Unmarshal(b, &m)
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := (&fieldDecoder{strict: true}).copyFields("", m, &TestFirestoreEncoded{})
+		if err != nil {
+			return nil, err
+		}
+		return n.(*TestFirestoreEncoded), nil
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		fields, err := MarshalFirestoreFields(&TestFirestoreEncoded{
+			Name:    "Jane",
+			Owner:   "projects/p/databases/(default)/documents/users/1",
+			Secret:  "hunter2",
+			Count:   42,
+			Created: time.Date(2022, 1, 2, 22, 19, 55, 897215000, time.UTC),
+			Geo:     GeoPoint{Latitude: 50.55, Longitude: -104.87},
+			Pin:     TestFirestoreLatLng{Lat: 0.5, Lng: -104.87},
+			Tags:    []string{"a"},
+			Labels:  map[string]string{"k": "v"},
+		})
+		assert.Nil(t, err, "Error should be nil")
+
+		assert.Equal(t, map[string]interface{}{"stringValue": "Jane"}, fields["name"], "name should be a stringValue")
+		assert.Equal(t, map[string]interface{}{"referenceValue": "projects/p/databases/(default)/documents/users/1"}, fields["owner"], "owner should be a referenceValue")
+		assert.NotContains(t, fields, "Secret", "Secret should be skipped")
+		assert.NotContains(t, fields, "-", "Secret should be skipped")
+		assert.Equal(t, map[string]interface{}{"integerValue": "42"}, fields["count"], "count should be an integerValue")
+		assert.Equal(t, map[string]interface{}{"timestampValue": "2022-01-02T22:19:55.897215Z"}, fields["createdAt"], "createdAt should be a timestampValue")
+		assert.Equal(t, map[string]interface{}{"geoPointValue": map[string]interface{}{"latitude": 50.55, "longitude": -104.87}}, fields["geo"], "geo should be a geoPointValue")
+		assert.Equal(t, map[string]interface{}{"geoPointValue": map[string]interface{}{"latitude": 0.5, "longitude": -104.87}}, fields["pin"], "latitude & longitude structs should be a geoPointValue")
+		assert.Equal(t, map[string]interface{}{"mapValue": map[string]interface{}{"fields": map[string]interface{}{"sku": map[string]interface{}{"stringValue": ""}, "qty": map[string]interface{}{"doubleValue": 0.0}}}}, fields["Address"], "other structs should be a mapValue")
+		assert.Equal(t, map[string]interface{}{"arrayValue": map[string]interface{}{"values": []interface{}{map[string]interface{}{"stringValue": "a"}}}}, fields["Tags"], "Tags should be an arrayValue")
+		assert.Equal(t, map[string]interface{}{"mapValue": map[string]interface{}{"fields": map[string]interface{}{"k": map[string]interface{}{"stringValue": "v"}}}}, fields["Labels"], "Labels should be a mapValue")
+		assert.Equal(t, map[string]interface{}{"nullValue": nil}, fields["Flags"], "nil maps should be a nullValue")
+		assert.Equal(t, map[string]interface{}{"nullValue": nil}, fields["Any"], "nil interfaces should be a nullValue")
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := MarshalFirestoreFields("string")
+		assert.True(t, errors.Is(err, ErrUnsupportedType), "Strings should not be encoded as fields")
+
+		_, err = MarshalFirestoreFields(map[string]interface{}{"fn": func() {}})
+		var fe *FieldError
+		if assert.True(t, errors.As(err, &fe), "Error should be a *FieldError") {
+			assert.Equal(t, "fn", fe.Path, "Path should be the field name")
+			assert.True(t, errors.Is(err, ErrUnsupportedType), "Functions should not be encoded")
+		}
+
+		_, err = MarshalFirestoreFields(map[int]string{1: "a"})
+		assert.True(t, errors.Is(err, ErrUnsupportedType), "Maps should have string keys")
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		err := quick.Check(func(v TestFirestoreEncoded) bool {
+			// skipped fields are not encoded
+			v.Secret = ""
+
+			n, err := roundTrip(v)
+			if err != nil {
+				t.Log(err)
+				return false
+			}
+			return assert.Equal(t, v, *n, "Decode(Encode(v)) should equal v")
+		}, nil)
+		assert.Nil(t, err, "Decode(Encode(v)) should equal v")
+	})
+}
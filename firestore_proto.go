@@ -0,0 +1,262 @@
+package register
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The 2nd gen Firestore CloudEvents deliver the google.events.cloud.firestore.v1.DocumentEventData message
+// encoded as protobuf. The functions below decode the message into the same JSON structure that is
+// delivered to 1st gen functions, so that the FirestoreEvent & the field decoding can be shared.
+//
+//	DocumentEventData { Document value = 1; Document old_value = 2; DocumentMask update_mask = 3; }
+//	Document          { string name = 1; map<string, Value> fields = 2; Timestamp create_time = 3; Timestamp update_time = 4; }
+//	DocumentMask      { repeated string field_paths = 1; }
+//	Value             { oneof: boolean_value = 1; integer_value = 2; double_value = 3; reference_value = 5; map_value = 6;
+//	                    geo_point_value = 8; array_value = 9; timestamp_value = 10; null_value = 11; string_value = 17; bytes_value = 18; }
+//	ArrayValue        { repeated Value values = 1; }
+//	MapValue          { map<string, Value> fields = 1; }
+
+// protoDocumentEventData converts a protobuf encoded DocumentEventData to the JSON structure of a FirestoreEvent
+func protoDocumentEventData(b []byte) (map[string]interface{}, error) {
+	evt := map[string]interface{}{}
+	mask := []interface{}{}
+
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1, 2:
+			doc, err := protoDocument(v)
+			if err != nil {
+				return err
+			}
+			if num == 1 {
+				evt["value"] = doc
+			} else {
+				evt["oldValue"] = doc
+			}
+		case 3:
+			return protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 {
+					mask = append(mask, string(v))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode DocumentEventData: %w", err)
+	}
+
+	evt["updateMask"] = map[string]interface{}{"fieldPaths": mask}
+	return evt, nil
+}
+
+func protoDocument(b []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	fields := map[string]interface{}{}
+
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			doc["name"] = string(v)
+		case 2:
+			return protoMapEntry(v, fields)
+		case 3, 4:
+			t, err := protoTimestamp(v)
+			if err != nil {
+				return err
+			}
+			if num == 3 {
+				doc["createTime"] = t
+			} else {
+				doc["updateTime"] = t
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc["fields"] = fields
+	return doc, nil
+}
+
+// protoMapEntry decodes a single map<string, Value> entry into the given fields
+func protoMapEntry(b []byte, fields map[string]interface{}) error {
+	var key string
+	var value map[string]interface{}
+
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			val, err := protoValue(v)
+			if err != nil {
+				return err
+			}
+			value = val
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		// a Value with all default fields is encoded as an empty message
+		value = map[string]interface{}{"nullValue": nil}
+	}
+
+	fields[key] = value
+	return nil
+}
+
+func protoValue(b []byte) (map[string]interface{}, error) {
+	value := map[string]interface{}{"nullValue": nil}
+
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			value = map[string]interface{}{"booleanValue": n != 0}
+		case 2:
+			value = map[string]interface{}{"integerValue": fmt.Sprintf("%d", int64(n))}
+		case 3:
+			value = map[string]interface{}{"doubleValue": protoDouble(math.Float64frombits(n))}
+		case 5:
+			value = map[string]interface{}{"referenceValue": string(v)}
+		case 6:
+			fields := map[string]interface{}{}
+			err := protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 {
+					return protoMapEntry(v, fields)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			value = map[string]interface{}{"mapValue": map[string]interface{}{"fields": fields}}
+		case 8:
+			geo := map[string]interface{}{"latitude": 0.0, "longitude": 0.0}
+			err := protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				switch num {
+				case 1:
+					geo["latitude"] = math.Float64frombits(n)
+				case 2:
+					geo["longitude"] = math.Float64frombits(n)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			value = map[string]interface{}{"geoPointValue": geo}
+		case 9:
+			values := []interface{}{}
+			err := protoFields(v, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+				if num == 1 {
+					val, err := protoValue(v)
+					if err != nil {
+						return err
+					}
+					values = append(values, val)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			value = map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+		case 10:
+			t, err := protoTimestamp(v)
+			if err != nil {
+				return err
+			}
+			value = map[string]interface{}{"timestampValue": t}
+		case 11:
+			value = map[string]interface{}{"nullValue": nil}
+		case 17:
+			value = map[string]interface{}{"stringValue": string(v)}
+		case 18:
+			value = map[string]interface{}{"bytesValue": base64.StdEncoding.EncodeToString(v)}
+		}
+		return nil
+	})
+
+	return value, err
+}
+
+// protoDouble returns the JSON representation of a double, which uses strings for the special values
+func protoDouble(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
+
+// protoTimestamp decodes a google.protobuf.Timestamp to a RFC3339 string
+func protoTimestamp(b []byte) (string, error) {
+	var seconds, nanos int64
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			seconds = int64(n)
+		case 2:
+			nanos = int64(int32(n))
+		}
+		return nil
+	})
+
+	return time.Unix(seconds, nanos).UTC().Format(time.RFC3339Nano), err
+}
+
+// protoFields iterates over the fields of a protobuf message
+// length delimited fields are passed as v, varint & fixed fields are passed as n
+func protoFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, l = protowire.ConsumeFixed32(b)
+			n = uint64(n32)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		if err := fn(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package register
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DocumentRef is a reference to a Firestore document, as received in a referenceValue or the name of a FirestoreValue
+// "projects/{project}/databases/{database}/documents/{collection}/{id}/..."
+type DocumentRef struct {
+	Project  string
+	Database string
+	Path     string // the path of the document within the database: "users/{uid}/orders/{id}"
+}
+
+// ParseDocumentRef parses the full resource name of a Firestore document
+func ParseDocumentRef(name string) (DocumentRef, error) {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) < 7 || parts[0] != "projects" || parts[2] != "databases" || parts[4] != "documents" {
+		return DocumentRef{}, fmt.Errorf("invalid document reference: expected projects/{project}/databases/{database}/documents/{path}: got %q", name)
+	}
+
+	docPath := parts[5:]
+	if len(docPath)%2 != 0 {
+		return DocumentRef{}, fmt.Errorf("invalid document reference: path is a collection: got %q", name)
+	}
+	for _, p := range docPath {
+		if p == "" {
+			return DocumentRef{}, fmt.Errorf("invalid document reference: empty path segment: got %q", name)
+		}
+	}
+
+	return DocumentRef{
+		Project:  parts[1],
+		Database: parts[3],
+		Path:     strings.Join(docPath, "/"),
+	}, nil
+}
+
+// ID returns the id of the document, the last segment of the path
+func (r DocumentRef) ID() string {
+	return path.Base(r.Path)
+}
+
+// Collection returns the path of the collection containing the document: "users/{uid}/orders"
+func (r DocumentRef) Collection() string {
+	return path.Dir(r.Path)
+}
+
+// Parent returns the document containing the collection of the document, or nil for a root collection
+func (r DocumentRef) Parent() *DocumentRef {
+	parent := path.Dir(r.Collection())
+	if parent == "." {
+		return nil
+	}
+	return &DocumentRef{Project: r.Project, Database: r.Database, Path: parent}
+}
+
+// IsZero reports whether the reference is empty
+func (r DocumentRef) IsZero() bool {
+	return r == DocumentRef{}
+}
+
+// String returns the full resource name of the document
+func (r DocumentRef) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("projects/%s/databases/%s/documents/%s", r.Project, r.Database, r.Path)
+}
@@ -0,0 +1,47 @@
+package register
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentRef(t *testing.T) {
+	t.Run("Parse", func(t *testing.T) {
+		ref, err := ParseDocumentRef("projects/my-project/databases/(default)/documents/users/1/orders/2")
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "my-project", ref.Project, "Project should be parsed")
+		assert.Equal(t, "(default)", ref.Database, "Database should be parsed")
+		assert.Equal(t, "users/1/orders/2", ref.Path, "Path should be parsed")
+		assert.Equal(t, "2", ref.ID(), "ID should be the last segment")
+		assert.Equal(t, "users/1/orders", ref.Collection(), "Collection should be the collection path")
+		assert.Equal(t, "projects/my-project/databases/(default)/documents/users/1/orders/2", ref.String(), "String should be the full name")
+
+		parent := ref.Parent()
+		if assert.NotNil(t, parent, "Parent should not be nil") {
+			assert.Equal(t, "users/1", parent.Path, "Parent should be the containing document")
+			assert.Equal(t, "users", parent.Collection(), "Parent collection should be users")
+			assert.Nil(t, parent.Parent(), "Parent of a root document should be nil")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, name := range []string{
+			"",
+			"users/1",
+			"projects/p/databases/(default)/documents",
+			"projects/p/databases/(default)/documents/users",
+			"projects/p/databases/(default)/documents/users/1/orders",
+			"projects/p/databases/(default)/documents/users//orders/1",
+			"projects/p/instances/(default)/documents/users/1",
+		} {
+			_, err := ParseDocumentRef(name)
+			assert.NotNil(t, err, "Error should not be nil: %q", name)
+		}
+	})
+
+	t.Run("Zero", func(t *testing.T) {
+		assert.True(t, DocumentRef{}.IsZero(), "empty reference should be zero")
+		assert.Equal(t, "", DocumentRef{}.String(), "empty reference should be an empty string")
+	})
+}
@@ -65,6 +65,9 @@ import (
 }
 */
 
+// testFirestoreUpdate is the update event shown above
+const testFirestoreUpdate = `{"oldValue":{"createTime":"2022-01-02T22:19:55.897215Z","fields":{"BB":{"booleanValue":true},"M":{"mapValue":{"fields":{"Asd":{"integerValue":"2355"},"Bfg":{"booleanValue":true}}}},"MS":{"mapValue":{"fields":{"A":{"stringValue":"ertert"},"B":{"integerValue":"6544"}}}},"NNNNN":{"integerValue":"123"},"geo":{"geoPointValue":{"latitude":50.55,"longitude":-104.87}}},"name":"projects/cleanflo-admin/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN","updateTime":"2022-01-03T03:39:46.371407Z"},"updateMask":{"fieldPaths":["MS.B"]},"value":{"createTime":"2022-01-02T22:19:55.897215Z","fields":{"BB":{"booleanValue":true},"M":{"mapValue":{"fields":{"Asd":{"integerValue":"2355"},"Bfg":{"booleanValue":true}}}},"MS":{"mapValue":{"fields":{"A":{"stringValue":"ertert"},"B":{"integerValue":"1234"}}}},"NNNNN":{"integerValue":"123"},"geo":{"geoPointValue":{"latitude":50.55,"longitude":-104.87}}},"name":"projects/cleanflo-admin/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN","updateTime":"2022-01-03T03:41:22.930655Z"}}`
+
 type TestFirestoreI struct {
 	NNNNN float64
 	BB    bool
@@ -85,7 +88,8 @@ type TestFirestoreI struct {
 		Lat float64
 		Lng float64
 	}
-	T time.Time
+	T   time.Time
+	Geo GeoPoint `fx:"geo"`
 }
 
 func TestFirestore(t *testing.T) {
@@ -117,7 +121,7 @@ func TestFirestore(t *testing.T) {
 	})
 
 	testDec := &Decoder{}
-	err := json.Unmarshal([]byte(`{"oldValue":{"createTime":"2022-01-02T22:19:55.897215Z","fields":{"BB":{"booleanValue":true},"M":{"mapValue":{"fields":{"Asd":{"integerValue":"2355"},"Bfg":{"booleanValue":true}}}},"MS":{"mapValue":{"fields":{"A":{"stringValue":"ertert"},"B":{"integerValue":"6544"}}}},"NNNNN":{"integerValue":"123"},"geo":{"geoPointValue":{"latitude":50.55,"longitude":-104.87}}},"name":"projects/cleanflo-admin/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN","updateTime":"2022-01-03T03:39:46.371407Z"},"updateMask":{"fieldPaths":["MS.B"]},"value":{"createTime":"2022-01-02T22:19:55.897215Z","fields":{"BB":{"booleanValue":true},"M":{"mapValue":{"fields":{"Asd":{"integerValue":"2355"},"Bfg":{"booleanValue":true}}}},"MS":{"mapValue":{"fields":{"A":{"stringValue":"ertert"},"B":{"integerValue":"1234"}}}},"NNNNN":{"integerValue":"123"},"geo":{"geoPointValue":{"latitude":50.55,"longitude":-104.87}}},"name":"projects/cleanflo-admin/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN","updateTime":"2022-01-03T03:41:22.930655Z"}}`), testDec)
+	err := json.Unmarshal([]byte(testFirestoreUpdate), testDec)
 	if err != nil {
 		t.Errorf("Error unmarshalling test firestore data: %v", err)
 	}
@@ -125,6 +129,9 @@ func TestFirestore(t *testing.T) {
 	testFsFunc := func(ctx context.Context, e FirestoreEvent) error {
 		assert.IsType(t, &TestFirestoreI{}, e.OldValue.Fields, "OldValue.Fields did not match expected type")
 		assert.IsType(t, &TestFirestoreI{}, e.Value.Fields, "Value.Fields did not match expected type")
+		if v, ok := e.Value.Fields.(*TestFirestoreI); ok {
+			assert.Equal(t, GeoPoint{Latitude: 50.55, Longitude: -104.87}, v.Geo, "Geo should be decoded from the geo field")
+		}
 
 		fmt.Println(e.vars)
 
@@ -219,4 +226,105 @@ func TestFirestore(t *testing.T) {
 		assert.Nil(t, err, "Error should be nil")
 	})
 
+	t.Run("Recursive Wildcard", func(t *testing.T) {
+		var vars map[string]string
+		fs := reg.Firestore().Collection("tenants").Document("{tid}").Collection("{document=**}").Write(nil, func(ctx context.Context, e FirestoreEvent) error {
+			vars = e.Vars()
+			return nil
+		})
+		single := reg.Firestore().Collection("tenants").Document("{tid}").Collection("users").Document("{uid}").Write(nil, testFsFunc)
+		assert.Equal(t, "tenants/*/**", fs.Path(), "Path should end with the recursive wildcard")
+		assert.Same(t, fs, reg.findFirestore(FirestoreDocumentWriteEvent, "tenants/acme/users/1/orders/2"), "Recursive function should match subcollections")
+		assert.Same(t, single, reg.findFirestore(FirestoreDocumentWriteEvent, "tenants/acme/users/1"), "Single segment function should take precedence")
+
+		err := reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+			EventType: string(FirestoreDocumentWriteEvent),
+			Resource: &metadata.Resource{
+				RawPath: "projects/[project-name]/databases/(default)/documents/tenants/acme/users/1/orders/2",
+			},
+		}), testDec)
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, map[string]string{"tid": "acme", "document": "users/1/orders/2"}, vars, "document should hold the remaining segments")
+	})
+	t.Run("Database", func(t *testing.T) {
+		reg := NewRegister()
+		databases := map[string]string{}
+		onWrite := func(name string) FirestoreFunc {
+			return func(ctx context.Context, e FirestoreEvent) error {
+				databases[name] = e.Database()
+				return nil
+			}
+		}
+
+		def := reg.Firestore().Collection("events").Document("{id}").Write(nil, onWrite("default"))
+		analytics := reg.Firestore().Database("analytics").Collection("events").Document("{id}").Write(nil, onWrite("analytics"))
+		assert.Equal(t, "(default)", def.DatabaseID(), "DatabaseID should be (default)")
+		assert.Equal(t, "analytics", analytics.DatabaseID(), "DatabaseID should be analytics")
+		assert.NotEqual(t, def.Name(), analytics.Name(), "Names should not collide")
+		assert.Len(t, reg.firestore[FirestoreDocumentWriteEvent], 2, "Paths should not collide")
+
+		assert.Same(t, def, reg.findFirestore(FirestoreDocumentWriteEvent, "projects/p/databases/(default)/documents/events/1"), "Default database should match")
+		assert.Same(t, analytics, reg.findFirestore(FirestoreDocumentWriteEvent, "projects/p/databases/analytics/documents/events/1"), "Named database should match")
+		assert.Nil(t, reg.findFirestore(FirestoreDocumentWriteEvent, "projects/p/databases/other/documents/events/1"), "Other databases should not match")
+
+		for _, db := range []string{"(default)", "analytics"} {
+			err := reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+				EventType: string(FirestoreDocumentWriteEvent),
+				Resource: &metadata.Resource{
+					RawPath: "projects/p/databases/" + db + "/documents/events/1",
+				},
+			}), testDec)
+			assert.Nil(t, err, "Error should be nil")
+		}
+		assert.Equal(t, map[string]string{"default": "(default)", "analytics": "analytics"}, databases, "Event should expose the database")
+	})
+}
+
+func TestFirestoreValue(t *testing.T) {
+	event := func(t *testing.T, s string) FirestoreEvent {
+		evt := FirestoreEvent{}
+		err := json.Unmarshal([]byte(s), &evt)
+		if err != nil {
+			t.Fatalf("Error unmarshalling test firestore event: %v", err)
+		}
+		return evt
+	}
+
+	t.Run("Document", func(t *testing.T) {
+		evt := event(t, testFirestoreUpdate)
+		assert.True(t, evt.Value.Exists(), "Value should exist")
+		assert.Equal(t, "testColl/5914E2YLVWcUDHisQwQN", evt.Value.Path(), "Path should be relative to documents/")
+		assert.Equal(t, "5914E2YLVWcUDHisQwQN", evt.Value.ID(), "ID should be the last segment")
+		assert.Equal(t, "testColl", evt.Value.Collection(), "Collection should be testColl")
+		assert.Equal(t, "", evt.Value.Parent(), "Parent should be empty for a root collection")
+
+		v := FirestoreValue{Name: "projects/p/databases/analytics/documents/users/1/orders/2"}
+		assert.Equal(t, "users/1/orders/2", v.Path(), "Path should be relative to documents/")
+		assert.Equal(t, "2", v.ID(), "ID should be 2")
+		assert.Equal(t, "users/1/orders", v.Collection(), "Collection should be users/1/orders")
+		assert.Equal(t, "users/1", v.Parent(), "Parent should be users/1")
+	})
+
+	t.Run("Event Kind", func(t *testing.T) {
+		name := `"name": "projects/p/databases/(default)/documents/users/1"`
+		for kind, tt := range map[string]struct {
+			json                   string
+			create, update, delete bool
+		}{
+			"Create": {`{"oldValue": {}, "value": {` + name + `}}`, true, false, false},
+			"Update": {`{"oldValue": {` + name + `}, "value": {` + name + `}}`, false, true, false},
+			"Delete": {`{"oldValue": {` + name + `}, "value": {}}`, false, false, true},
+		} {
+			evt := event(t, tt.json)
+			assert.Equal(t, tt.create, evt.IsCreate(), "%s: IsCreate", kind)
+			assert.Equal(t, tt.update, evt.IsUpdate(), "%s: IsUpdate", kind)
+			assert.Equal(t, tt.delete, evt.IsDelete(), "%s: IsDelete", kind)
+		}
+
+		evt := event(t, `{"oldValue": {}, "value": {}}`)
+		assert.False(t, evt.Value.Exists(), "Value should not exist")
+		assert.Equal(t, "", evt.Value.ID(), "ID should be empty")
+		assert.Equal(t, "", evt.Value.Collection(), "Collection should be empty")
+		assert.Equal(t, "", evt.Value.Parent(), "Parent should be empty")
+	})
 }
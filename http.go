@@ -46,7 +46,11 @@ func (f *FunctionRegistrar) HTTP(path string, handler http.HandlerFunc) *HttpFun
 		fn:   handler,
 		path: path,
 	}
+	fn.target = fn
 
+	if _, ok := f.handlers[path]; !ok {
+		f.paths = append(f.paths, path)
+	}
 	f.handlers[path] = fn
 
 	return fn
@@ -63,6 +67,7 @@ func (f *FunctionRegistrar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // HttpFunction is a wrapper for mux.Route and the parent FunctionRegistrar
 type HttpFunction struct {
+	DeployOptions[*HttpFunction]
 	reg *FunctionRegistrar
 	r   *mux.Route
 	// unauthenticated bool
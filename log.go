@@ -71,7 +71,7 @@ func (l LogLevel) Msg(msg string, fields map[string]interface{}) {
 
 // Err is a wrapper for logrus.Error
 func (l LogLevel) Err(msg string, err error) error {
-	err = fmt.Errorf("%s: %v", msg, err)
+	err = fmt.Errorf("%s: %w", msg, err)
 	l.Msgf(msg, err)
 	return err
 }
@@ -0,0 +1,172 @@
+package register
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+var (
+	camelRegexp   *regexp.Regexp
+	invalidRegexp *regexp.Regexp
+	nameRegexp    *regexp.Regexp
+)
+
+func init() {
+	var err error
+	camelRegexp, err = regexp.Compile(`([a-z0-9])([A-Z])`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	invalidRegexp, err = regexp.Compile(`[^a-z0-9]+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	nameRegexp, err = regexp.Compile(`^[a-zA-Z]([a-zA-Z0-9_-]*[a-zA-Z0-9])?$`)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hashLength is the number of hex characters of the hash appended to shortened & colliding names
+const hashLength = 8
+
+// FunctionInfo describes a registered function to a NamingStrategy
+type FunctionInfo struct {
+	Event    EventType // the event the function is registered to: "providers/cloud.firestore/eventTypes/document.create"
+	Trigger  string    // the readable representation of the event: "firestoreDocCreate"
+	Database string    // the ID of the Firestore database, empty for the default database & other triggers
+	Resource string    // the resource of the function as registered: "users/{uid}"
+}
+
+// NamingStrategy generates the names of the deployed functions, see FunctionRegistrar.WithNaming
+// names set with Named on a function are used as is
+type NamingStrategy interface {
+	FunctionName(fn FunctionInfo) string
+}
+
+// NamingFunc is an adapter to use a function as a NamingStrategy
+type NamingFunc func(fn FunctionInfo) string
+
+// FunctionName calls n(fn)
+func (n NamingFunc) FunctionName(fn FunctionInfo) string {
+	return n(fn)
+}
+
+// DefaultNaming is the NamingStrategy used unless FunctionRegistrar.WithNaming is set
+// names are lower case kebab of the trigger, database & resource: "firestore-doc-create-users-uid"
+// any character other than a letter or digit separates words, names over 63 characters are shortened with a hash of the trigger:
+// "{the first 54 characters}-{8 hex characters}"
+var DefaultNaming NamingStrategy = NamingFunc(defaultName)
+
+// defaultName implements DefaultNaming
+func defaultName(fn FunctionInfo) string {
+	parts := []string{fn.Trigger}
+	if fn.Database != "" {
+		parts = append(parts, fn.Database)
+	}
+	parts = append(parts, fn.Resource)
+
+	name := strings.ToLower(camelRegexp.ReplaceAllString(strings.Join(parts, "-"), "$1-$2"))
+	name = strings.Trim(invalidRegexp.ReplaceAllString(name, "-"), "-")
+	if len(name) > maxNameLength {
+		return hashedName(name, fmt.Sprintf("%s %s %s", fn.Event, fn.Database, fn.Resource))
+	}
+	return name
+}
+
+// hashedName appends a hash of the id to the name, shortening the name to fit within 63 characters
+func hashedName(name, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	suffix := hex.EncodeToString(sum[:])[:hashLength]
+
+	if max := maxNameLength - hashLength - 1; len(name) > max {
+		name = strings.TrimRight(name[:max], "-_")
+	}
+	return name + "-" + suffix
+}
+
+// WithNaming sets the NamingStrategy used to generate the names of the deployed functions, by default DefaultNaming
+// generated names that collide with the name of a function registered before them have a hash of their trigger appended
+//
+//	reg.WithNaming(register.NamingFunc(func(fn register.FunctionInfo) string {
+//		return "prod-" + register.DefaultNaming.FunctionName(fn)
+//	}))
+func (f *FunctionRegistrar) WithNaming(n NamingStrategy) *FunctionRegistrar {
+	f.naming = n
+	f.names = nil
+	return f
+}
+
+// functionName returns the name of a registered function: the name set with Named,
+// otherwise the name generated by the NamingStrategy, see functionNames
+func (f *FunctionRegistrar) functionName(fn registeredFunction) string {
+	d := fn.deployer()
+	if d.name != "" {
+		return d.name
+	}
+	if name, ok := f.functionNames()[d.key]; ok {
+		return name
+	}
+	return f.generatedName(fn)
+}
+
+// functionNames returns the name of the deployed function of each trigger, mapped by the key of the trigger
+// triggers are named in the order they were first registered, a generated name that collides with the name of an earlier trigger
+// has a hash of the trigger appended, so that registering a function never renames a function registered before it
+// the names are cached until a function is registered or named, the returned map must not be modified
+func (f *FunctionRegistrar) functionNames() map[string]string {
+	if f.names != nil {
+		return f.names
+	}
+
+	names := make(map[string]string, len(f.events))
+	taken := make(map[string]bool, len(f.events))
+	for _, fn := range f.registered {
+		key := fn.deployer().key
+		if _, ok := names[key]; ok {
+			continue
+		}
+		ev, ok := f.events[key].(registeredFunction)
+		if !ok {
+			continue
+		}
+
+		name := ev.deployer().name
+		if name == "" {
+			name = f.generatedName(ev)
+			if taken[name] {
+				name = hashedName(name, key)
+			}
+		}
+		names[key] = name
+		taken[name] = true
+	}
+	f.names = names
+	return names
+}
+
+// generatedName returns the name of the function generated by the NamingStrategy
+func (f *FunctionRegistrar) generatedName(fn registeredFunction) string {
+	d := fn.deployer()
+	info := FunctionInfo{
+		Event:    fn.Event(),
+		Resource: d.resource,
+	}
+	if d.event != nil {
+		info.Trigger = d.event.String()
+	}
+	if db := eventDatabase(fn); db != defaultDatabase {
+		info.Database = db
+	}
+
+	if f.naming == nil {
+		return DefaultNaming.FunctionName(info)
+	}
+	return f.naming.FunctionName(info)
+}
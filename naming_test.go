@@ -0,0 +1,143 @@
+package register
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNaming(t *testing.T) {
+	noopFirestore := func(ctx context.Context, e FirestoreEvent) error { return nil }
+	noopStorage := func(ctx context.Context, e StorageEvent) error { return nil }
+	noopRTDB := func(ctx context.Context, e RTDBEvent) error { return nil }
+	noopPubSub := func(ctx context.Context, m PubSubMessage) error { return nil }
+	noopAuth := func(ctx context.Context, e AuthEvent) error { return nil }
+
+	t.Run("Default", func(t *testing.T) {
+		// recursive wildcards are only valid for 2nd gen functions
+		reg := NewRegister().Gen2(true)
+		assert.Equal(t, "firestore-doc-create-users-uid", reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore).Name(), "Name should be kebab case")
+		assert.Equal(t, "firestore-doc-write-analytics-events-event-id", reg.Firestore().Database("analytics").Collection("events").Document("{eventId}").Write(TestFirestoreI{}, noopFirestore).Name(), "Name should include the database")
+		assert.Equal(t, "firestore-doc-delete-users-uid-orders-oid", reg.Firestore().Collection("users").Document("{uid}").Collection("orders").Document("{oid}").Delete(TestFirestoreI{}, noopFirestore).Name(), "Name should include every wildcard")
+		assert.Equal(t, "firestore-doc-update-tenants-tid-document", reg.Firestore().Collection("tenants").Document("{tid}").Collection("{document=**}").Update(TestFirestoreI{}, noopFirestore).Name(), "Name should include recursive wildcards")
+		assert.Equal(t, "rtdb-ref-write-messages-push-id", reg.RealtimeDB().Ref("messages/{pushId}").Write(TestRTDBI{}, noopRTDB).Name(), "Name should be kebab case")
+		assert.Equal(t, "storage-object-finalize-my-bucket-example-com", reg.Storage().Bucket("My_Bucket.example.com").Finalize(noopStorage).Name(), "Name should not contain the raw bucket")
+		assert.Equal(t, "pubsub-publish-orders-v1", reg.PubSub("orders.v1").Publish(TestPubSubI{}, noopPubSub).Name(), "Name should not contain the raw topic")
+		assert.Equal(t, "auth-user-delete", reg.Authentication().Delete(noopAuth).Name(), "Name should be kebab case")
+
+		assert.Nil(t, reg.Validate(), "generated names should be valid")
+	})
+
+	t.Run("Long Names", func(t *testing.T) {
+		reg := NewRegister()
+		long := reg.Firestore().Collection("tenants").Document("{tenantId}").Collection("projects").Document("{projectId}").
+			Collection("tasks").Document("{taskId}").Collection("comments").Document("{commentId}").Create(TestFirestoreI{}, noopFirestore)
+		other := reg.Firestore().Collection("tenants").Document("{tenantId}").Collection("projects").Document("{projectId}").
+			Collection("tasks").Document("{taskId}").Collection("comments").Document("{replyId}").Update(TestFirestoreI{}, noopFirestore)
+
+		name := long.Name()
+		assert.LessOrEqual(t, len(name), maxNameLength, "Name should be shortened")
+		assert.True(t, strings.HasPrefix(name, "firestore-doc-create-tenants-tenant-id-projects"), "Name should keep the start of the name: %s", name)
+		assert.Regexp(t, `-[0-9a-f]{8}$`, name, "Name should end with a hash")
+		assert.Equal(t, name, long.Name(), "Name should be stable")
+		assert.NotEqual(t, name, other.Name(), "Names should not collide")
+		assert.Nil(t, reg.Validate(), "shortened names should be valid")
+	})
+
+	t.Run("Collisions", func(t *testing.T) {
+		reg := NewRegister()
+		wildcard := reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		name := wildcard.Name()
+		literal := reg.Firestore().Collection("users").Document("uid").Create(TestFirestoreI{}, noopFirestore)
+		chained := reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+
+		assert.Equal(t, "firestore-doc-create-users-uid", name, "Name should be kebab case")
+		assert.Equal(t, name, wildcard.Name(), "registering a colliding function should not rename the existing function")
+		assert.NotEqual(t, wildcard.Name(), literal.Name(), "Names should not collide")
+		assert.Regexp(t, `^firestore-doc-create-users-uid-[0-9a-f]{8}$`, literal.Name(), "Name of the later function should end with a hash")
+		assert.Equal(t, wildcard.Name(), chained.Name(), "handlers of the same trigger should share the name")
+		assert.Nil(t, reg.Validate(), "Error should be nil")
+
+		named := reg.Firestore().Named("firestore-doc-create-users-uid").Collection("users").Document("{uid}").Collection("posts").Document("{pid}").Create(TestFirestoreI{}, noopFirestore)
+		assert.Equal(t, name, wildcard.Name(), "registering a colliding Named function should not rename the existing function")
+		assert.Equal(t, name, named.Name(), "Named should not be changed")
+		assert.True(t, errors.Is(reg.Validate(), ErrDuplicateName), "colliding Named functions should be reported by Validate")
+	})
+
+	t.Run("Named", func(t *testing.T) {
+		reg := NewRegister()
+		fs := reg.Firestore().Named("on-signup").Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		chained := reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		db := reg.RealtimeDB().Named("on-message").Ref("messages/{pushId}").Write(TestRTDBI{}, nil)
+		st := reg.Storage().Named("on-upload").Bucket("uploads").Finalize(noopStorage)
+		ps := reg.PubSub("orders").Named("on-order")
+		auth := reg.Authentication().Named("on-user-delete").Delete(nil)
+
+		assert.Equal(t, "on-signup", fs.Name(), "Name should be overridden")
+		assert.Equal(t, "on-signup", chained.Name(), "Name should be kept by handlers of the same trigger")
+		assert.Equal(t, "on-message", db.Name(), "Name should be overridden")
+		assert.Equal(t, "on-upload", st.Name(), "Name should be overridden")
+		assert.Equal(t, "on-order", ps.Name(), "Name should be overridden")
+		assert.Equal(t, "on-user-delete", auth.Name(), "Name should be overridden")
+
+		cmd := reg.DeployCloud()
+		for _, name := range []string{"on-signup", "on-message", "on-upload", "on-order", "on-user-delete"} {
+			assert.Contains(t, cmd, "\\\n"+name+" --trigger", "deploy command should use the name")
+		}
+	})
+
+	t.Run("Invalid Names", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Named("on/signup").Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Storage().Named("OnUpload").Bucket("uploads").Finalize(noopStorage)
+		reg.Storage().Named("OnUpload").Bucket("uploads").Delete(noopStorage)
+
+		var ve *ValidationError
+		if assert.True(t, errors.As(reg.Validate(), &ve), "Error should be *ValidationError") && assert.Len(t, ve.Errors, 2, "Errors should contain the invalid & duplicate names") {
+			assert.True(t, errors.Is(ve.Errors[0], ErrDuplicateName), "Error should be ErrDuplicateName: %s", ve.Errors[0])
+			assert.True(t, errors.Is(ve.Errors[1], ErrInvalidName), "Error should be ErrInvalidName: %s", ve.Errors[1])
+		}
+
+		reg.Gen2(true)
+		assert.Len(t, reg.Validate().(*ValidationError).Errors, 4, "upper case names should be invalid for 2nd gen functions")
+	})
+
+	t.Run("WithNaming", func(t *testing.T) {
+		reg := NewRegister().WithNaming(NamingFunc(func(fn FunctionInfo) string {
+			return "prod-" + DefaultNaming.FunctionName(fn)
+		}))
+		fs := reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		named := reg.Storage().Named("on-upload").Bucket("uploads").Finalize(noopStorage)
+
+		assert.Equal(t, "prod-firestore-doc-create-users-uid", fs.Name(), "Name should use the NamingStrategy")
+		assert.Equal(t, "on-upload", named.Name(), "Named should override the NamingStrategy")
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		calls := 0
+		reg := NewRegister().WithNaming(NamingFunc(func(fn FunctionInfo) string {
+			calls++
+			return DefaultNaming.FunctionName(fn)
+		}))
+		fns := []*PubSubFunction{}
+		for _, topic := range []string{"a", "b", "c", "d"} {
+			fns = append(fns, reg.PubSub(topic).Publish(nil, noopPubSub))
+		}
+
+		for i := 0; i < 3; i++ {
+			for _, fn := range fns {
+				fn.Name()
+			}
+		}
+		assert.Nil(t, reg.Validate(), "Error should be nil")
+		assert.Equal(t, len(fns), calls, "names should be generated once until a function is registered or named")
+
+		fns[0].Named("renamed")
+		assert.Equal(t, "renamed", fns[0].Name(), "Named should reset the cached names")
+		reg.PubSub("e").Publish(nil, noopPubSub)
+		assert.Equal(t, "pubsub-publish-e", reg.PubSub("e").Name(), "registering should reset the cached names")
+	})
+}
@@ -0,0 +1,233 @@
+package register
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeySource provides the RSA public keys used to verify the signature of OIDC tokens by their key id
+type KeySource interface {
+	PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+// KeySourceFunc is an adapter to use a function as a KeySource
+type KeySourceFunc func(ctx context.Context, kid string) (*rsa.PublicKey, error)
+
+// PublicKey calls k(ctx, kid)
+func (k KeySourceFunc) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	return k(ctx, kid)
+}
+
+// GoogleKeySource provides the keys signing the OIDC tokens of Google service accounts, used by default to verify push requests
+var GoogleKeySource KeySource = NewJWKSKeySource("https://www.googleapis.com/oauth2/v3/certs")
+
+// googleIssuers are the issuers of the OIDC tokens of Google service accounts
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+const (
+	jwksRefresh = time.Hour   // keys are fetched again after this duration
+	jwksRetry   = time.Minute // unknown key ids & failed fetches only trigger a fetch once in this duration
+	oidcLeeway  = time.Minute // allowed clock skew when checking the expiry, issue & not before times of tokens
+	oidcMaxAge  = time.Hour   // maximum lifetime of a token from its issue time, the lifetime of Google OIDC tokens
+)
+
+// JWKSKeySource fetches the RSA keys from a JSON Web Key Set URL, caching them for an hour
+type JWKSKeySource struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetched   time.Time // time the keys were last fetched
+	attempted time.Time // time of the last fetch, successful or not
+}
+
+// NewJWKSKeySource creates a JWKSKeySource fetching the keys from the url
+func NewJWKSKeySource(url string) *JWKSKeySource {
+	return &JWKSKeySource{
+		url:    url,
+		client: http.DefaultClient,
+	}
+}
+
+// PublicKey returns the key with the key id, the keys are fetched again when expired or the key id is unknown
+// a key that is already cached is returned when the keys fail to be fetched again
+func (j *JWKSKeySource) PublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	key, ok := j.keys[kid]
+	if ok && time.Since(j.fetched) < jwksRefresh {
+		return key, nil
+	}
+	if time.Since(j.attempted) < jwksRetry {
+		if ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	j.attempted = time.Now()
+	keys, err := j.fetch(ctx)
+	if err != nil {
+		if ok {
+			Debug.Msgf("failed to refresh keys, using the cached key %q: %s", kid, err)
+			return key, nil
+		}
+		return nil, fmt.Errorf("failed to fetch keys: %s", err)
+	}
+	j.keys, j.fetched = keys, j.attempted
+
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// fetch retrieves & parses the RSA keys of the key set
+func (j *JWKSKeySource) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", j.url, resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid modulus: %s", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid exponent: %s", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// oidcClaims are the claims of the OIDC token sent with push requests
+type oidcClaims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Expiry        int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	NotBefore     int64  `json:"nbf"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// verifyOIDCToken verifies the RS256 signature & claims of a Google OIDC token
+// the token must be issued, valid from & expire within the leeway of now, expiring at most an hour after it was issued
+// the email is only checked when not empty
+func verifyOIDCToken(ctx context.Context, token string, keys KeySource, audience, email string) (*oidcClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unexpected algorithm %q", header.Alg)
+	}
+
+	key, err := keys.PublicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %s", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %s", err)
+	}
+
+	var claims oidcClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err)
+	}
+
+	now := time.Now()
+	exp, iat, nbf := time.Unix(claims.Expiry, 0), time.Unix(claims.IssuedAt, 0), time.Unix(claims.NotBefore, 0)
+	switch {
+	case !contains(googleIssuers, claims.Issuer):
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case audience == "" || claims.Audience != audience:
+		return nil, fmt.Errorf("unexpected audience %q", claims.Audience)
+	case claims.Expiry == 0 || now.After(exp.Add(oidcLeeway)):
+		return nil, fmt.Errorf("token expired at %s", exp.UTC())
+	case claims.IssuedAt == 0:
+		return nil, fmt.Errorf("token has no issue time")
+	case iat.After(now.Add(oidcLeeway)):
+		return nil, fmt.Errorf("token issued in the future at %s", iat.UTC())
+	case claims.NotBefore != 0 && nbf.After(now.Add(oidcLeeway)):
+		return nil, fmt.Errorf("token not valid before %s", nbf.UTC())
+	case exp.Sub(iat) > oidcMaxAge:
+		return nil, fmt.Errorf("token lifetime of %s exceeds %s", exp.Sub(iat), oidcMaxAge)
+	case email != "" && (claims.Email != email || !claims.EmailVerified):
+		return nil, fmt.Errorf("unexpected email %q", claims.Email)
+	}
+	return &claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package register
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Memory is the amount of memory allocated to a function when deploying
+type Memory int
+
+const (
+	Memory128MB Memory = 128
+	Memory256MB Memory = 256 // default
+	Memory512MB Memory = 512
+	Memory1GB   Memory = 1024
+	Memory2GB   Memory = 2048
+	Memory4GB   Memory = 4096
+	Memory8GB   Memory = 8192
+	Memory16GB  Memory = 16384
+	Memory32GB  Memory = 32768
+)
+
+// String returns the memory in the format expected by the --memory flag: "256MB"
+func (m Memory) String() string {
+	return fmt.Sprintf("%dMB", int(m))
+}
+
+// deployOption flags an option of deployOptions as set
+type deployOption uint8
+
+const (
+	optMemory deployOption = 1 << iota
+	optTimeout
+	optRegion
+	optMinInstances
+	optMaxInstances
+	optServiceAccount
+)
+
+// deployOptions are the options that can be set per function or as defaults on the FunctionRegistrar
+// options that are not set are excluded from the deploy command, a set option overrides the registrar default even when zero:
+// MinInstances(0) deploys with --min-instances 0 & Timeout(0) with the default timeout of Cloud Functions
+type deployOptions struct {
+	set            deployOption
+	memory         Memory
+	timeout        time.Duration
+	region         string
+	minInstances   int
+	maxInstances   int
+	serviceAccount string
+	labels         map[string]string
+}
+
+// has reports whether the option was set
+func (d deployOptions) has(o deployOption) bool {
+	return d.set&o != 0
+}
+
+// merge returns a copy of the options with all values set in o taking precedence
+// labels are merged, with the labels in o replacing labels with the same key
+func (d deployOptions) merge(o deployOptions) deployOptions {
+	if o.has(optMemory) {
+		d.memory = o.memory
+	}
+	if o.has(optTimeout) {
+		d.timeout = o.timeout
+	}
+	if o.has(optRegion) {
+		d.region = o.region
+	}
+	if o.has(optMinInstances) {
+		d.minInstances = o.minInstances
+	}
+	if o.has(optMaxInstances) {
+		d.maxInstances = o.maxInstances
+	}
+	if o.has(optServiceAccount) {
+		d.serviceAccount = o.serviceAccount
+	}
+	d.set |= o.set
+
+	labels := make(map[string]string, len(d.labels)+len(o.labels))
+	for k, v := range d.labels {
+		labels[k] = v
+	}
+	for k, v := range o.labels {
+		labels[k] = v
+	}
+	d.labels = labels
+
+	return d
+}
+
+// combine merges the options of several functions that are deployed as a single function,
+// the largest memory, timeout & instances that are set are kept, the first region & service account that are set are kept
+func (d deployOptions) combine(o deployOptions) deployOptions {
+	if o.has(optMemory) && (!d.has(optMemory) || o.memory > d.memory) {
+		d.memory = o.memory
+	}
+	if o.has(optTimeout) && (!d.has(optTimeout) || o.timeout > d.timeout) {
+		d.timeout = o.timeout
+	}
+	if o.has(optRegion) && !d.has(optRegion) {
+		d.region = o.region
+	}
+	if o.has(optMinInstances) && (!d.has(optMinInstances) || o.minInstances > d.minInstances) {
+		d.minInstances = o.minInstances
+	}
+	if o.has(optMaxInstances) && (!d.has(optMaxInstances) || o.maxInstances > d.maxInstances) {
+		d.maxInstances = o.maxInstances
+	}
+	if o.has(optServiceAccount) && !d.has(optServiceAccount) {
+		d.serviceAccount = o.serviceAccount
+	}
+	d.set |= o.set
+
+	labels := make(map[string]string, len(d.labels)+len(o.labels))
+	for k, v := range o.labels {
+		labels[k] = v
+	}
+	for k, v := range d.labels {
+		labels[k] = v
+	}
+	d.labels = labels
+
+	return d
+}
+
+// labelKeys returns the label keys in sorted order
+func (d deployOptions) labelKeys() []string {
+	keys := make([]string, 0, len(d.labels))
+	for k := range d.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String outputs the options as flags for the gcloud functions deploy command
+func (d deployOptions) String() (s string) {
+	if d.memory != 0 {
+		s += fmt.Sprintf(" --memory \"%s\"", d.memory)
+	}
+
+	if d.timeout != 0 {
+		s += fmt.Sprintf(" --timeout \"%ds\"", int(d.timeout.Seconds()))
+	}
+
+	if d.region != "" {
+		s += fmt.Sprintf(" --region \"%s\"", d.region)
+	}
+
+	if d.has(optMinInstances) {
+		s += fmt.Sprintf(" --min-instances %d", d.minInstances)
+	}
+
+	if d.maxInstances != 0 {
+		s += fmt.Sprintf(" --max-instances %d", d.maxInstances)
+	} else if d.has(optMaxInstances) {
+		s += " --clear-max-instances"
+	}
+
+	if d.serviceAccount != "" {
+		s += fmt.Sprintf(" --service-account \"%s\"", d.serviceAccount)
+	}
+
+	if len(d.labels) > 0 {
+		labels := []string{}
+		for _, k := range d.labelKeys() {
+			labels = append(labels, fmt.Sprintf("%s=%s", k, d.labels[k]))
+		}
+		s += fmt.Sprintf(" --update-labels \"%s\"", strings.Join(labels, ","))
+	}
+
+	return s
+}
+
+// deployOptioner is implemented by functions that carry their own deploy options
+type deployOptioner interface {
+	deployOptions() deployOptions
+}
+
+// DeployOptions sets the options of a function when deploying, overriding the registrar defaults
+// embedded in each function so that the options can be chained with the other methods of the function:
+//
+//	f.Firestore().Collection("users").Document("{uid}").Memory(register.Memory1GB).MinInstances(1).Create(User{}, onCreate)
+//
+// all http routes are deployed as a single function which receives the largest memory, timeout & instances of all routes,
+// and the region & service account of the first route registered with a region or service account
+type DeployOptions[T any] struct {
+	target  T // the function returned by the setters
+	options deployOptions
+}
+
+// deployOptions returns the options set on the function
+func (o *DeployOptions[T]) deployOptions() deployOptions {
+	return o.options
+}
+
+// Memory sets the memory for the function when deploying, overrides the registrar default
+func (o *DeployOptions[T]) Memory(m Memory) T {
+	o.options.memory = m
+	o.options.set |= optMemory
+	return o.target
+}
+
+// Timeout sets the timeout for the function when deploying, overrides the registrar default
+// a zero timeout deploys with the default timeout of Cloud Functions
+func (o *DeployOptions[T]) Timeout(d time.Duration) T {
+	o.options.timeout = d
+	o.options.set |= optTimeout
+	return o.target
+}
+
+// Region sets the region for the function when deploying, overrides the registrar default
+func (o *DeployOptions[T]) Region(region string) T {
+	o.options.region = region
+	o.options.set |= optRegion
+	return o.target
+}
+
+// MinInstances sets the minimum number of instances for the function when deploying, overrides the registrar default
+func (o *DeployOptions[T]) MinInstances(n int) T {
+	o.options.minInstances = n
+	o.options.set |= optMinInstances
+	return o.target
+}
+
+// MaxInstances sets the maximum number of instances for the function when deploying, overrides the registrar default
+// zero removes the limit
+func (o *DeployOptions[T]) MaxInstances(n int) T {
+	o.options.maxInstances = n
+	o.options.set |= optMaxInstances
+	return o.target
+}
+
+// ServiceAccount sets the service account email for the function when deploying, overrides the registrar default
+func (o *DeployOptions[T]) ServiceAccount(email string) T {
+	o.options.serviceAccount = email
+	o.options.set |= optServiceAccount
+	return o.target
+}
+
+// Labels adds the given labels to the function when deploying, merged with the registrar labels
+func (o *DeployOptions[T]) Labels(labels map[string]string) T {
+	o.options.labels = addLabels(o.options.labels, labels)
+	return o.target
+}
+
+// functionOptions returns the options for the given function with the registrar defaults applied
+func (f *FunctionRegistrar) functionOptions(fn CloudDeployFunction) deployOptions {
+	if o, ok := fn.(deployOptioner); ok {
+		return f.options.merge(o.deployOptions())
+	}
+	return f.options.merge(deployOptions{})
+}
+
+// httpOptions returns the options for the http function with the registrar defaults applied
+// all routes are deployed as a single function, so the options of every HttpFunction are combined in registration order
+func (f *FunctionRegistrar) httpOptions() deployOptions {
+	o := deployOptions{}
+	for _, p := range f.paths {
+		o = o.combine(f.handlers[p].options)
+	}
+
+	return f.options.merge(o)
+}
+
+// WithMemory sets the default memory for all functions when deploying
+func (f *FunctionRegistrar) WithMemory(m Memory) *FunctionRegistrar {
+	f.options.memory = m
+	f.options.set |= optMemory
+	return f
+}
+
+// WithTimeout sets the default timeout for all functions when deploying
+func (f *FunctionRegistrar) WithTimeout(d time.Duration) *FunctionRegistrar {
+	f.options.timeout = d
+	f.options.set |= optTimeout
+	return f
+}
+
+// WithRegion sets the default region for all functions when deploying
+func (f *FunctionRegistrar) WithRegion(region string) *FunctionRegistrar {
+	f.options.region = region
+	f.options.set |= optRegion
+	return f
+}
+
+// WithMinInstances sets the default minimum number of instances for all functions when deploying
+func (f *FunctionRegistrar) WithMinInstances(n int) *FunctionRegistrar {
+	f.options.minInstances = n
+	f.options.set |= optMinInstances
+	return f
+}
+
+// WithMaxInstances sets the default maximum number of instances for all functions when deploying
+func (f *FunctionRegistrar) WithMaxInstances(n int) *FunctionRegistrar {
+	f.options.maxInstances = n
+	f.options.set |= optMaxInstances
+	return f
+}
+
+// WithServiceAccount sets the default service account email for all functions when deploying
+func (f *FunctionRegistrar) WithServiceAccount(email string) *FunctionRegistrar {
+	f.options.serviceAccount = email
+	f.options.set |= optServiceAccount
+	return f
+}
+
+// WithLabels adds the given labels to all functions when deploying
+func (f *FunctionRegistrar) WithLabels(labels map[string]string) *FunctionRegistrar {
+	f.options.labels = addLabels(f.options.labels, labels)
+	return f
+}
+
+func addLabels(dst, src map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
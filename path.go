@@ -10,8 +10,7 @@ import (
 )
 
 var (
-	wildcardRegexp  *regexp.Regexp
-	normalizeRegexp *regexp.Regexp
+	wildcardRegexp *regexp.Regexp
 )
 
 func init() {
@@ -20,18 +19,69 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	normalizeRegexp, err = regexp.Compile(`/[^\w](.*)[^\w]/?`)
-	if err != nil {
-		log.Fatal(err)
+// recursiveWildcard matches the remaining segments of a path: "tenants/{tid}/{document=**}" or "tenants/{tid}/**"
+const recursiveWildcard = "**"
+
+type pathKeys []string
+
+func (x pathKeys) Len() int      { return len(x) }
+func (x pathKeys) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+// Less orders the most specific path first:
+// paths without a recursive wildcard, then the paths with the most segments,
+// then by the first segment that differs: a literal segment before a * before a **
+func (x pathKeys) Less(i, j int) bool {
+	a, b := strings.Split(x[i], "/"), strings.Split(x[j], "/")
+	if ra, rb := isRecursivePath(a), isRecursivePath(b); ra != rb {
+		return rb
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
 	}
+	for n := range a {
+		if sa, sb := segmentRank(a[n]), segmentRank(b[n]); sa != sb {
+			return sa < sb
+		}
+	}
+	return x[i] > x[j]
 }
 
-type pathKeys []string
+// segmentRank ranks a segment of a registered path by how much it matches: literal, pattern, recursive wildcard
+func segmentRank(seg string) int {
+	switch {
+	case seg == recursiveWildcard:
+		return 2
+	case strings.ContainsAny(seg, `*?[\`):
+		return 1
+	}
+	return 0
+}
 
-func (x pathKeys) Len() int           { return len(x) }
-func (x pathKeys) Less(i, j int) bool { return x[i] > x[j] } // longest first
-func (x pathKeys) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+// isRecursivePath reports whether the segments of a registered path end with a recursive wildcard
+func isRecursivePath(segs []string) bool {
+	return len(segs) > 0 && segs[len(segs)-1] == recursiveWildcard
+}
+
+// pathSegment returns the segment of a registered path with the wildcard replaced, and the var name of the wildcard
+//
+//	"{uid}" = "*", "uid"
+//	"{document=**}" = "**", "document=**"
+//	"*" & "**" are unnamed and keyed by their position
+func pathSegment(part string) (string, string) {
+	if wildcardRegexp.MatchString(part) {
+		name := wildcard(part)
+		if strings.HasSuffix(name, "="+recursiveWildcard) {
+			return recursiveWildcard, name
+		}
+		return "*", name
+	}
+	if part == "*" || part == recursiveWildcard {
+		return part, part
+	}
+	return part, ""
+}
 
 func wildcard(s string) string {
 	i := strings.Index(s, "{")
@@ -45,15 +95,15 @@ func wildcard(s string) string {
 }
 
 // Uses path.Match to match the given path to given pathKeys
-// Paths are sorted by length, so the longest path (i.e. most precise) is matched first
-// pathkeys have wildcards replaced with *
+// Paths are sorted by specificity, so the most precise path is matched first, see pathKeys.Less
+// pathkeys have wildcards replaced with * or **, a trailing ** matches one or more segments
 func findPath(keys pathKeys, ref string) string {
-	// sort the paths by length, longest first
+	// sort the paths by specificity, most specific first
 	sort.Sort(keys)
 
 	// try to match the given path to the registered paths
 	for _, k := range keys {
-		if ok, err := path.Match(k, ref); ok && err == nil {
+		if ok, err := matchPath(k, ref); ok && err == nil {
 			return k
 		} else if err != nil {
 			Debug.Errf("error matching path %s to registered path %s: %s", ref, k, err)
@@ -62,18 +112,48 @@ func findPath(keys pathKeys, ref string) string {
 	return ""
 }
 
+// matchPath reports whether ref matches the registered path, a trailing ** matches the remaining segments
+func matchPath(key, ref string) (bool, error) {
+	keyParts := strings.Split(key, "/")
+	if !isRecursivePath(keyParts) {
+		return path.Match(key, ref)
+	}
+
+	prefix := keyParts[:len(keyParts)-1]
+	refParts := strings.Split(ref, "/")
+	if len(refParts) <= len(prefix) {
+		return false, nil
+	}
+	for _, part := range refParts[len(prefix):] {
+		if part == "" {
+			return false, nil
+		}
+	}
+	return path.Match(path.Join(prefix...), path.Join(refParts[:len(prefix)]...))
+}
+
 // ExtractVars extracts the variables from the path and saves them to the pathWildcards map.
 // Unnamed wildcards (*) can be accessed using the index of the wildcard.
+// Recursive wildcards ({document=**} or **) hold the remaining segments of the path joined by "/"
 func extractVars(ref string, wildcards map[int]string) map[string]string {
 	vars := make(map[string]string)
 	pathParts := strings.Split(path.Clean(ref), "/")
 	for idx, name := range wildcards {
-		if name == "*" {
+		if idx >= len(pathParts) {
+			continue
+		}
+		value := pathParts[idx]
+		if name == recursiveWildcard || strings.HasSuffix(name, "="+recursiveWildcard) {
+			// the remaining segments of the path: "users/123"
+			value = strings.Join(pathParts[idx:], "/")
+			name = strings.TrimSuffix(name, "="+recursiveWildcard)
+		}
+		if name == "*" || name == recursiveWildcard {
 			// use k as the name of the wildcard
-			vars[fmt.Sprintf("%d", idx)] = pathParts[idx]
+			vars[fmt.Sprintf("%d", idx)] = value
 			continue
 		}
-		vars[name] = pathParts[idx]
+		vars[name] = value
 	}
 
 	return vars
@@ -1,6 +1,8 @@
 package register
 
 import (
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -38,6 +40,48 @@ func TestPath(t *testing.T) {
 		assert.Equal(t, "", findPath(p, "/msg/*/user/*"), "Should not find, found %s", findPath(p, "/msg/*/user/*"))
 	})
 
+	t.Run("Recursive Wildcards", func(t *testing.T) {
+		p := pathKeys{
+			"tenants/**",
+			"tenants/*/**",
+			"tenants/*/users/*",
+			"tenants/acme/**",
+			"tenants/*/users/**",
+			"tenants/acme/users/*",
+		}
+
+		assert.Equal(t, "tenants/acme/users/*", findPath(p, "tenants/acme/users/1"), "Should prefer the literal segment")
+		assert.Equal(t, "tenants/*/users/*", findPath(p, "tenants/other/users/1"), "Should prefer single segment wildcards")
+		assert.Equal(t, "tenants/*/users/**", findPath(p, "tenants/other/users/1/orders/2"), "Should prefer the longest recursive prefix")
+		assert.Equal(t, "tenants/acme/**", findPath(p, "tenants/acme/orders/2"), "Should prefer the literal recursive prefix")
+		assert.Equal(t, "tenants/*/**", findPath(p, "tenants/other/orders/2"), "Should match the remaining segments")
+		assert.Equal(t, "tenants/**", findPath(p, "tenants/other"), "Should match a single remaining segment")
+
+		assert.Equal(t, "", findPath(p, "tenants"), "Should not match without remaining segments")
+		assert.Equal(t, "", findPath(p, "tenants/other/"), "Should not match empty segments")
+		assert.Equal(t, "", findPath(p, "users/1"), "Should not match other paths")
+
+		for i := 0; i < 10; i++ {
+			q := append(pathKeys{}, p...)
+			rand.Shuffle(len(q), q.Swap)
+			sort.Sort(q)
+			assert.Equal(t, pathKeys{
+				"tenants/acme/users/*",
+				"tenants/*/users/*",
+				"tenants/*/users/**",
+				"tenants/acme/**",
+				"tenants/*/**",
+				"tenants/**",
+			}, q, "Order should not depend on the registration order")
+		}
+
+		vars := extractVars("tenants/acme/users/1/orders/2", map[int]string{1: "tid", 2: "document=**"})
+		assert.Equal(t, map[string]string{"tid": "acme", "document": "users/1/orders/2"}, vars, "Should extract the remaining segments")
+
+		vars = extractVars("tenants/acme/users/1", map[int]string{1: "*", 2: "**"})
+		assert.Equal(t, map[string]string{"1": "acme", "2": "users/1"}, vars, "Should extract unnamed wildcards by position")
+	})
+
 	t.Run("ExtractVars", func(t *testing.T) {
 		cards := map[int]string{
 			1: "uid",
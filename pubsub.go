@@ -2,51 +2,136 @@ package register
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"reflect"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/functions/metadata"
 )
 
 // PubSub registers a function to the specified event, or returns the existing function if one already exists
 func (f *FunctionRegistrar) PubSub(topic string) *PubSubFunction {
-	if cf, ok := f.events[fmt.Sprintf("%s-%s", PubSubPublishEvent, topic)]; ok {
-		if p, ok := cf.(*PubSubFunction); ok {
-			return p
-		}
+	if p := f.findPubSub(topic); p != nil {
+		return p
 	}
 
 	p := &PubSubFunction{
 		reg: f,
 	}
+	p.target = p
 
 	p.event = PubSubPublishEvent
 	p.resource = topic
-	p.reg.events[p.Name()] = p
+	p.reg.addEvent(topic, p)
 
 	return p
 }
 
+// findPubSub returns the function registered to the topic, otherwise nil
+// unlike PubSub, a function is not registered when none exists
+func (f *FunctionRegistrar) findPubSub(topic string) *PubSubFunction {
+	if cf, ok := f.findEvent(eventKey(PubSubPublishEvent.Type(), topic)); ok {
+		if p, ok := cf.(*PubSubFunction); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// pubsubTopic returns the name of the topic of the metadata resource: "projects/{project}/topics/{topic}"
+// the resource is set as the Name, or as the RawPath when the resource is delivered as a string
+func pubsubTopic(r *metadata.Resource) string {
+	name := r.Name
+	if name == "" {
+		name = r.RawPath
+	}
+
+	if i := strings.LastIndex(name, "/topics/"); i >= 0 {
+		return name[i+len("/topics/"):]
+	}
+	return strings.TrimPrefix(name, "topics/")
+}
+
+// ErrPubSubDecode is returned by PubSubFunction.HandleCloudEvent when the message or its data does not decode into the registered type
+// redelivering the message cannot succeed, push subscriptions acknowledge these messages, see FunctionRegistrar.PushSubscription
+var ErrPubSubDecode = errors.New("undecodable message")
+
 // PubSubFunction is a wrapper for the PubSubFunc and the parent FunctionRegistrar
 // Implements the CloudEventFunction interface
 type PubSubFunction struct {
 	cloudDeployer
-	reg  *FunctionRegistrar
-	fn   PubSubFunc
-	data interface{}
+	DeployOptions[*PubSubFunction]
+	reg      *FunctionRegistrar
+	fn       PubSubFunc
+	data     interface{}
+	codec    PubSubCodec     // decodes the message data, JSONCodec when nil
+	branches []*PubSubBranch // checked in order before the default fn, see When
+	push     bool            // served by a push subscription instead of deployed, see FunctionRegistrar.PushSubscription
+}
+
+// PubSubBranch is a handler of a PubSubFunction called for the messages matched by its predicate
+// Each branch decodes the message data into its own type, see PubSubFunction.When
+type PubSubBranch struct {
+	parent *PubSubFunction
+	match  func(m PubSubMessage) bool
+	fn     PubSubFunc
+	data   interface{}
+	codec  PubSubCodec // decodes the message data, the codec of the parent when nil
 }
 
 // PubSubFunc is the function signature for the Pub/Sub CloudEvent
 type PubSubFunc func(ctx context.Context, m PubSubMessage) error
 
-// PubSubMessage is the expected payload for Pub/Sub CloudEvents.
+// PubSubMessage is the message received by the PubSubFunc
+// Data is a pointer to the type registered with Publish, decoded from the message data by the codec of the function:
+// *T when registered with T{} or &T{}, the raw []byte of the message when registered with nil
+// MessageID & PublishTime are set from the context metadata when the payload does not include them
 type PubSubMessage struct {
-	Topic string      `json:"topic"`
-	Data  interface{} `json:"data"`
+	Topic       string            `json:"topic"`
+	Data        interface{}       `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
+	OrderingKey string            `json:"orderingKey"`
+}
+
+// pubsubEnvelope is the payload of Pub/Sub CloudEvents: {"data": "<base64>", "attributes": {...}}
+// the data is base64 decoded by encoding/json
+type pubsubEnvelope struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
+	OrderingKey string            `json:"orderingKey"`
+}
+
+// Named sets the name the function is deployed with, overriding the NamingStrategy of the registrar
+func (p *PubSubFunction) Named(name string) *PubSubFunction {
+	p.name = name
+	p.reg.names = nil
+	return p
+}
+
+// Codec sets the PubSubCodec used to decode the message data into the registered type, by default JSONCodec
+//
+//	f.PubSub("audit").Codec(register.TextCodec).Publish("", onAudit)
+func (p *PubSubFunction) Codec(c PubSubCodec) *PubSubFunction {
+	p.codec = c
+	return p
+}
+
+// pubsubCodec returns the codec used to decode the message data: JSONCodec unless set with Codec
+func (p *PubSubFunction) pubsubCodec() PubSubCodec {
+	if p.codec == nil {
+		return JSONCodec
+	}
+	return p.codec
 }
 
 // Publish registers the specified function to the specific topic for the Pub/Sub CloudEvent
 // The provided data is used to populate the Data field of the PubSubMessage received by the function
+// When branches are registered with When or WhenFunc, fn is the default branch for the messages none of them match
 //google.pubsub.topic.publish
 func (p *PubSubFunction) Publish(data interface{}, fn PubSubFunc) *PubSubFunction {
 	p.data = data
@@ -55,34 +140,131 @@ func (p *PubSubFunction) Publish(data interface{}, fn PubSubFunc) *PubSubFunctio
 	return p
 }
 
+// When adds a branch for the messages with the attribute set to value, the branches share the deployed function of the topic
+// The first matching branch handles the message, messages matching no branch are handled by the function set with Publish
+//
+//	f.PubSub("orders").
+//		When("event_type", "created").Publish(OrderCreated{}, onCreated).
+//		When("event_type", "cancelled").Publish(OrderCancelled{}, onCancelled).
+//		Publish(Order{}, onOrder)
+func (p *PubSubFunction) When(attr, value string) *PubSubBranch {
+	return p.WhenFunc(func(m PubSubMessage) bool {
+		v, ok := m.Attributes[attr]
+		return ok && v == value
+	})
+}
+
+// WhenFunc adds a branch for the messages the predicate returns true for, see When
+// The predicate receives the message before the data is decoded, Data is nil
+func (p *PubSubFunction) WhenFunc(pred func(m PubSubMessage) bool) *PubSubBranch {
+	b := &PubSubBranch{
+		parent: p,
+		match:  pred,
+	}
+	p.branches = append(p.branches, b)
+	return b
+}
+
+// Codec sets the PubSubCodec used to decode the message data of the branch, by default the codec of the function
+func (b *PubSubBranch) Codec(c PubSubCodec) *PubSubBranch {
+	b.codec = c
+	return b
+}
+
+// Publish registers the specified function to the branch
+// The provided data is used to populate the Data field of the PubSubMessage received by the function
+// Returns the PubSubFunction of the topic to continue adding branches
+func (b *PubSubBranch) Publish(data interface{}, fn PubSubFunc) *PubSubFunction {
+	b.data = data
+	b.fn = fn
+
+	return b.parent
+}
+
+// branch returns the data, codec & handler of the first branch matching the message, otherwise those of the default branch
+// matched reports whether a branch matched the message
+func (p *PubSubFunction) branch(m PubSubMessage) (data interface{}, codec PubSubCodec, fn PubSubFunc, matched bool) {
+	for _, b := range p.branches {
+		if b.match != nil && b.match(m) {
+			if b.codec != nil {
+				return b.data, b.codec, b.fn, true
+			}
+			return b.data, p.pubsubCodec(), b.fn, true
+		}
+	}
+	return p.data, p.pubsubCodec(), p.fn, false
+}
+
 // CloudEventFunction
 
-// HandleCloudEvent handles the PubSub CloudEvent and calls the registered PubSubFunction
+// HandleCloudEvent handles the PubSub CloudEvent and calls the registered PubSubFunction, or the first branch matching the message
+// the base64 data of the message is decoded into the type registered to the branch by its codec
 func (a *PubSubFunction) HandleCloudEvent(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
-	msg := reflect.New(reflect.TypeOf(a.data)).Interface()
-
-	err := dec.Decode(&msg)
+	var env pubsubEnvelope
+	err := dec.Decode(&env)
 	if err != nil {
-		return Debug.Errf("failed to decode PubSubPublishEvent [%s]: %s: %s", md.EventType, err, string(dec.data))
+		return Debug.Errf("failed to decode PubSubPublishEvent [%s]: %w: %s: %s", md.EventType, ErrPubSubDecode, err, string(dec.data))
 	}
 
 	m := PubSubMessage{
-		Topic: a.resource,
-		Data:  msg,
+		Topic:       a.resource,
+		Attributes:  env.Attributes,
+		MessageID:   env.MessageID,
+		PublishTime: env.PublishTime,
+		OrderingKey: env.OrderingKey,
+	}
+	if m.MessageID == "" {
+		m.MessageID = md.EventID
+	}
+	if m.PublishTime.IsZero() {
+		m.PublishTime = md.Timestamp
 	}
 
-	if a.fn != nil {
-		err = a.fn(ctx, m)
-		if err != nil {
-			return Debug.Errf("registered PubSubFunc failed [%s]: %s: PubSubFunc %+v", md.EventType, err, a)
-		}
+	data, codec, fn, matched := a.branch(m)
+	if fn == nil && (matched || len(a.branches) == 0) {
+		return Debug.Errf("no PubSubFunc registered for [%s]: %s: %w", md.EventType, a.Resource(), ErrNilHandler)
+	}
+	if fn == nil {
+		Debug.Msgf("skipped pubsubfunc [%s]: %s: no branch matched attributes: %v", md.EventType, a.Name(), m.Attributes)
+		return nil
+	}
+
+	m.Data, err = decodePubSubData(codec, data, env.Data)
+	if err != nil {
+		return Debug.Errf("failed to decode PubSubPublishEvent data [%s]: %w: %s: %T", md.EventType, ErrPubSubDecode, err, data)
+	}
+
+	err = fn(ctx, m)
+	if err != nil {
+		return Debug.Errf("registered PubSubFunc failed [%s]: %s: PubSubFunc %+v", md.EventType, err, a)
 	}
 	return nil
 }
 
-// Name returns the name of the function: "pubsub.topic.publish/{topic}"
+// decodePubSubData decodes the message data with the codec into a new value of the registered type, returned as a pointer
+// data registered as a pointer is allocated as the type it points to, so that both T{} & &T{} are received as *T
+// data registered as nil receives the raw []byte of the message
+func decodePubSubData(codec PubSubCodec, data interface{}, b []byte) (interface{}, error) {
+	if data == nil {
+		return b, nil
+	}
+
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	msg := reflect.New(t).Interface()
+	if len(b) > 0 {
+		if err := codec.Unmarshal(b, msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// Name returns the name of the function: "pubsub-publish-{topic}", see FunctionRegistrar.WithNaming
 func (a *PubSubFunction) Name() string {
-	return fmt.Sprintf("%s-%s", a.event, a.Resource())
+	return a.reg.functionName(a)
 }
 
 // Resource returns the resource of the function: "{topic}"
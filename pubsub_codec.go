@@ -0,0 +1,125 @@
+package register
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// PubSubCodec decodes the data of a Pub/Sub message into the type registered with PubSubFunction.Publish,
+// and encodes values into the data of a message. The data is base64 decoded before Unmarshal is called
+type PubSubCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes the data with encoding/json, the default codec
+	JSONCodec PubSubCodec = jsonCodec{}
+	// RawCodec passes the data through as is, the registered type must be []byte
+	RawCodec PubSubCodec = rawCodec{}
+	// TextCodec encodes the data as plain text, the registered type must be a string or implement encoding.TextUnmarshaler
+	TextCodec PubSubCodec = textCodec{}
+	// ProtoCodec encodes the data as protobuf, the registered type must implement proto.Message
+	ProtoCodec PubSubCodec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	}
+	return nil, fmt.Errorf("raw codec: cannot encode %T, expected []byte", v)
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec: cannot decode into %T, expected *[]byte", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) Marshal(v interface{}) ([]byte, error) {
+	switch s := v.(type) {
+	case string:
+		return []byte(s), nil
+	case *string:
+		return []byte(*s), nil
+	case encoding.TextMarshaler:
+		return s.MarshalText()
+	case fmt.Stringer:
+		return []byte(s.String()), nil
+	}
+
+	// named string types: type Status string
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+		return []byte(rv.String()), nil
+	}
+	return nil, fmt.Errorf("text codec: cannot encode %T, expected a string or encoding.TextMarshaler", v)
+}
+
+func (textCodec) Unmarshal(data []byte, v interface{}) error {
+	switch s := v.(type) {
+	case *string:
+		*s = string(data)
+		return nil
+	case encoding.TextUnmarshaler:
+		return s.UnmarshalText(data)
+	}
+
+	// named string types: type Status string
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.String {
+		rv.Elem().SetString(string(data))
+		return nil
+	}
+	return fmt.Errorf("text codec: cannot decode into %T, expected *string or encoding.TextUnmarshaler", v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("proto codec: cannot encode %T, expected proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	// v may also be a pointer to a pointer to the message: **pb.Order
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		v = rv.Elem().Interface()
+	}
+
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("proto codec: cannot decode into %T, expected proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
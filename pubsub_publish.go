@@ -0,0 +1,372 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+)
+
+// PublishedMessage is a message encoded by the Publisher, ready to be sent to the topic
+type PublishedMessage struct {
+	Topic       string
+	Data        []byte
+	Attributes  map[string]string
+	OrderingKey string
+}
+
+// PubSubTransport sends the messages encoded by the Publisher, returning the id of the published message
+// implemented by PubSubClient & FakePubSub
+type PubSubTransport interface {
+	Publish(ctx context.Context, m PublishedMessage) (string, error)
+}
+
+// Publisher publishes Go values to Pub/Sub topics, encoded with the codec of the PubSubFunction registered to the topic
+//
+//	pub := f.Publisher()
+//	id, err := pub.Topic("orders").Attribute("event_type", "created").OrderingKey(order.Customer).Publish(ctx, order)
+type Publisher struct {
+	reg       *FunctionRegistrar
+	transport PubSubTransport
+}
+
+// NewPublisher creates a Publisher sending the messages with the transport
+// the codecs are looked up from the functions registered to reg, which may be nil
+func NewPublisher(reg *FunctionRegistrar, t PubSubTransport) *Publisher {
+	return &Publisher{
+		reg:       reg,
+		transport: t,
+	}
+}
+
+// Publisher creates a Publisher sending the messages with a PubSubClient to the project of the registrar
+// the project is set with WithProjectID, otherwise from the GOOGLE_CLOUD_PROJECT or GCP_PROJECT environment variables
+// each Publisher holds its own client: create one when the function starts & reuse it, see Publisher.Close
+func (f *FunctionRegistrar) Publisher() *Publisher {
+	project := f.projectID
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		project = os.Getenv("GCP_PROJECT")
+	}
+	return NewPublisher(f, NewPubSubClient(project))
+}
+
+// Close closes the transport when it holds a connection, eg. the client of a PubSubClient
+func (p *Publisher) Close() error {
+	if c, ok := p.transport.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Topic returns a TopicPublisher to publish a message to the topic
+func (p *Publisher) Topic(topic string) *TopicPublisher {
+	return &TopicPublisher{
+		pub:   p,
+		topic: topic,
+	}
+}
+
+// TopicPublisher builds a message for a topic, see Publisher.Topic
+type TopicPublisher struct {
+	pub         *Publisher
+	topic       string
+	attributes  map[string]string
+	orderingKey string
+	codec       PubSubCodec // overrides the codec of the registered function
+}
+
+// Attribute sets an attribute of the message
+func (t *TopicPublisher) Attribute(key, value string) *TopicPublisher {
+	if t.attributes == nil {
+		t.attributes = make(map[string]string)
+	}
+	t.attributes[key] = value
+	return t
+}
+
+// Attributes sets the attributes of the message, merged with those already set
+func (t *TopicPublisher) Attributes(attrs map[string]string) *TopicPublisher {
+	for k, v := range attrs {
+		t.Attribute(k, v)
+	}
+	return t
+}
+
+// OrderingKey sets the ordering key of the message, the subscription must have message ordering enabled
+func (t *TopicPublisher) OrderingKey(key string) *TopicPublisher {
+	t.orderingKey = key
+	return t
+}
+
+// Codec sets the PubSubCodec used to encode the data, overriding the codec of the registered function
+func (t *TopicPublisher) Codec(c PubSubCodec) *TopicPublisher {
+	t.codec = c
+	return t
+}
+
+// pubsubCodec returns the codec to encode the data: the codec set with Codec,
+// otherwise that of the branch of the registered function matching the attributes, JSONCodec when the topic is not registered
+func (t *TopicPublisher) pubsubCodec() PubSubCodec {
+	if t.codec != nil {
+		return t.codec
+	}
+	if t.pub.reg != nil {
+		if p := t.pub.reg.findPubSub(t.topic); p != nil {
+			_, codec, _, _ := p.branch(PubSubMessage{Topic: t.topic, Attributes: t.attributes, OrderingKey: t.orderingKey})
+			return codec
+		}
+	}
+	return JSONCodec
+}
+
+// Publish encodes the data & publishes the message, returning the id of the published message
+func (t *TopicPublisher) Publish(ctx context.Context, data interface{}) (string, error) {
+	b, err := t.pubsubCodec().Marshal(data)
+	if err != nil {
+		return "", Debug.Errf("failed to encode message for topic [%s]: %s: %T", t.topic, err, data)
+	}
+
+	id, err := t.pub.transport.Publish(ctx, PublishedMessage{
+		Topic:       t.topic,
+		Data:        b,
+		Attributes:  t.attributes,
+		OrderingKey: t.orderingKey,
+	})
+	if err != nil {
+		return "", Debug.Errf("failed to publish message to topic [%s]: %s", t.topic, err)
+	}
+	return id, nil
+}
+
+// PubSubClient publishes messages with the Pub/Sub client library: cloud.google.com/go/pubsub
+// the client uses Application Default Credentials, or the emulator without authentication when PUBSUB_EMULATOR_HOST is set
+type PubSubClient struct {
+	project string
+	opts    []option.ClientOption
+
+	mu     sync.Mutex
+	client *pubsub.Client
+	topics map[string]*pubsub.Topic
+}
+
+// NewPubSubClient creates a PubSubClient publishing to the topics of the project
+// the pubsub.Client is created with the options on the first message, see Close
+func NewPubSubClient(project string, opts ...option.ClientOption) *PubSubClient {
+	return &PubSubClient{
+		project: project,
+		opts:    opts,
+		topics:  make(map[string]*pubsub.Topic),
+	}
+}
+
+// WrapPubSubClient creates a PubSubClient publishing with the client, which is closed by Close
+func WrapPubSubClient(client *pubsub.Client) *PubSubClient {
+	return &PubSubClient{
+		client: client,
+		topics: make(map[string]*pubsub.Topic),
+	}
+}
+
+// topic returns the topic, creating the client on the first call
+// messages are published in order for each ordering key, the subscription must have message ordering enabled
+func (c *PubSubClient) topic(name string) (*pubsub.Topic, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		if c.project == "" {
+			return nil, fmt.Errorf("no project to publish to, see WithProjectID")
+		}
+		// the client outlives the context of a single message
+		client, err := pubsub.NewClient(context.Background(), c.project, c.opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pubsub client: %s", err)
+		}
+		c.client = client
+	}
+
+	t, ok := c.topics[name]
+	if !ok {
+		t = c.client.Topic(name)
+		t.EnableMessageOrdering = true
+		c.topics[name] = t
+	}
+	return t, nil
+}
+
+// Publish sends the message to the topic, waiting for the id of the published message
+// a failed message with an ordering key resumes publishing for the key, so that later messages are not rejected
+func (c *PubSubClient) Publish(ctx context.Context, m PublishedMessage) (string, error) {
+	t, err := c.topic(m.Topic)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := t.Publish(ctx, &pubsub.Message{
+		Data:        m.Data,
+		Attributes:  m.Attributes,
+		OrderingKey: m.OrderingKey,
+	}).Get(ctx)
+	if err != nil {
+		if m.OrderingKey != "" {
+			t.ResumePublish(m.OrderingKey)
+		}
+		return "", err
+	}
+	return id, nil
+}
+
+// Close sends the messages still batched by the topics & closes the client
+func (c *PubSubClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range c.topics {
+		t.Stop()
+	}
+	c.topics = make(map[string]*pubsub.Topic)
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
+
+// FakePubSub is an in-memory PubSubTransport for tests, it records the published messages
+// and can deliver them to the functions of the registrar through EntryPoint
+//
+//	fake := register.NewFakePubSub(f)
+//	... code under test publishing with fake.Publisher()
+//	msgs := fake.Messages("orders")
+//	err := fake.Deliver(ctx)
+//	dropped := fake.Undelivered("")
+type FakePubSub struct {
+	reg     *FunctionRegistrar
+	mu      sync.Mutex
+	project string
+	msgs    []fakeMessage
+	next    int // index of the first message not yet delivered
+}
+
+type fakeMessage struct {
+	PublishedMessage
+	id          string
+	publishTime time.Time
+	undelivered bool // no function was registered to the topic when the message was delivered
+}
+
+// NewFakePubSub creates a FakePubSub delivering messages to the functions of reg
+func NewFakePubSub(reg *FunctionRegistrar) *FakePubSub {
+	project := reg.projectID
+	if project == "" {
+		project = "fake-project"
+	}
+	return &FakePubSub{
+		reg:     reg,
+		project: project,
+	}
+}
+
+// Publisher returns a Publisher sending the messages to the fake
+func (f *FakePubSub) Publisher() *Publisher {
+	return NewPublisher(f.reg, f)
+}
+
+// Publish records the message, the ids are sequential starting at "1"
+func (f *FakePubSub) Publish(ctx context.Context, m PublishedMessage) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strconv.Itoa(len(f.msgs) + 1)
+	f.msgs = append(f.msgs, fakeMessage{PublishedMessage: m, id: id, publishTime: time.Now().UTC()})
+	return id, nil
+}
+
+// Messages returns the messages published to the topic in order, or every message when topic is empty
+func (f *FakePubSub) Messages(topic string) []PublishedMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var msgs []PublishedMessage
+	for _, m := range f.msgs {
+		if topic == "" || m.Topic == topic {
+			msgs = append(msgs, m.PublishedMessage)
+		}
+	}
+	return msgs
+}
+
+// Undelivered returns the messages Deliver skipped because no function is registered to their topic,
+// in the order they were published, or every skipped message when topic is empty
+func (f *FakePubSub) Undelivered(topic string) []PublishedMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var msgs []PublishedMessage
+	for _, m := range f.msgs {
+		if m.undelivered && (topic == "" || m.Topic == topic) {
+			msgs = append(msgs, m.PublishedMessage)
+		}
+	}
+	return msgs
+}
+
+// Deliver calls EntryPoint with each message not yet delivered, in the order they were published
+// messages published by the functions while delivering are delivered as well. Delivery stops at the first error
+// as a topic without subscriptions does, messages to a topic no function is registered to are skipped, see Undelivered
+func (f *FakePubSub) Deliver(ctx context.Context) error {
+	for {
+		f.mu.Lock()
+		if f.next >= len(f.msgs) {
+			f.mu.Unlock()
+			return nil
+		}
+		m := f.msgs[f.next]
+		if f.reg.findPubSub(m.Topic) == nil {
+			f.msgs[f.next].undelivered = true
+			f.next++
+			f.mu.Unlock()
+			Debug.Msgf("skipped message %s: no PubSubFunc registered for topic [%s]", m.id, m.Topic)
+			continue
+		}
+		f.next++
+		f.mu.Unlock()
+
+		data, err := json.Marshal(pubsubEnvelope{
+			Data:        m.Data,
+			Attributes:  m.Attributes,
+			MessageID:   m.id,
+			PublishTime: m.publishTime,
+			OrderingKey: m.OrderingKey,
+		})
+		if err != nil {
+			return Debug.Errf("failed to encode message %s for topic [%s]: %s", m.id, m.Topic, err)
+		}
+
+		mdCtx := metadata.NewContext(ctx, &metadata.Metadata{
+			EventID:   m.id,
+			Timestamp: m.publishTime,
+			EventType: string(PubSubPublishEvent),
+			Resource: &metadata.Resource{
+				Service: "pubsub.googleapis.com",
+				Name:    fmt.Sprintf("projects/%s/topics/%s", f.project, m.Topic),
+				Type:    "type.googleapis.com/google.pubsub.v1.PubsubMessage",
+			},
+		})
+		if err := f.reg.EntryPoint(mdCtx, &Decoder{data: data}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package register
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	pubsubpb "google.golang.org/genproto/googleapis/pubsub/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestPublisher(t *testing.T) {
+	t.Run("Codecs", func(t *testing.T) {
+		reg := NewRegister()
+		reg.PubSub("orders").
+			When("event_type", "status").Codec(TextCodec).Publish(TestPubSubStatus(""), nil).
+			Publish(TestPubSubI{}, nil)
+
+		fake := NewFakePubSub(reg)
+		pub := fake.Publisher()
+
+		id, err := pub.Topic("orders").Attribute("event_type", "created").OrderingKey("customer-1").Publish(context.Background(), TestPubSubI{Email: "other@email.com"})
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "1", id, "id should match")
+
+		id, err = pub.Topic("orders").Attributes(map[string]string{"event_type": "status"}).Publish(context.Background(), TestPubSubStatus("shipped"))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "2", id, "id should match")
+
+		_, err = pub.Topic("audit").Publish(context.Background(), map[string]int{"count": 1})
+		assert.Nil(t, err, "Error should be nil")
+
+		_, err = pub.Topic("raw").Codec(RawCodec).Publish(context.Background(), "not bytes")
+		assert.NotNil(t, err, "Error should not be nil when the data does not encode")
+
+		msgs := fake.Messages("orders")
+		if assert.Len(t, msgs, 2, "Messages should contain the messages of the topic") {
+			assert.JSONEq(t, `{"email": "other@email.com"}`, string(msgs[0].Data), "Data should be encoded by the codec of the function")
+			assert.Equal(t, map[string]string{"event_type": "created"}, msgs[0].Attributes, "Attributes should match")
+			assert.Equal(t, "customer-1", msgs[0].OrderingKey, "OrderingKey should match")
+			assert.Equal(t, []byte("shipped"), msgs[1].Data, "Data should be encoded by the codec of the matching branch")
+		}
+		if msgs := fake.Messages("audit"); assert.Len(t, msgs, 1, "Messages should contain the message of the topic") {
+			assert.JSONEq(t, `{"count": 1}`, string(msgs[0].Data), "Data should be JSON when the topic is not registered")
+		}
+		assert.Len(t, fake.Messages(""), 3, "Messages should contain every message")
+	})
+
+	t.Run("Deliver", func(t *testing.T) {
+		reg := NewRegister()
+		fake := NewFakePubSub(reg)
+		pub := fake.Publisher()
+
+		var received []PubSubMessage
+		reg.PubSub("orders").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+			received = append(received, m)
+			_, err := pub.Topic("emails").Attribute("template", "order").Publish(ctx, m.Data)
+			return err
+		})
+		reg.PubSub("emails").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+			received = append(received, m)
+			return nil
+		})
+
+		_, err := pub.Topic("orders").OrderingKey("customer-1").Publish(context.Background(), TestPubSubI{Email: "other@email.com"})
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, fake.Deliver(context.Background()), "Error should be nil")
+
+		if assert.Len(t, received, 2, "both functions should be called") {
+			assert.Equal(t, "orders", received[0].Topic, "Topic should match")
+			assert.Equal(t, "1", received[0].MessageID, "MessageID should match")
+			assert.Equal(t, "customer-1", received[0].OrderingKey, "OrderingKey should match")
+			assert.False(t, received[0].PublishTime.IsZero(), "PublishTime should be set")
+			assert.Equal(t, "emails", received[1].Topic, "messages published while delivering should be delivered")
+			assert.Equal(t, map[string]string{"template": "order"}, received[1].Attributes, "Attributes should match")
+			assert.Equal(t, &TestPubSubI{Email: "other@email.com"}, received[1].Data, "Data should be decoded")
+		}
+		assert.Nil(t, fake.Deliver(context.Background()), "messages should only be delivered once")
+		assert.Len(t, received, 2, "messages should only be delivered once")
+
+		assert.Empty(t, fake.Undelivered(""), "Undelivered should be empty")
+	})
+
+	t.Run("Deliver Unsubscribed", func(t *testing.T) {
+		reg := NewRegister()
+		fake := NewFakePubSub(reg)
+		pub := fake.Publisher()
+
+		var received []PubSubMessage
+		reg.PubSub("orders").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+			received = append(received, m)
+			_, err := pub.Topic("analytics").Publish(ctx, m.Data)
+			return err
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := pub.Topic("orders").Publish(context.Background(), TestPubSubI{Email: "other@email.com"})
+			assert.Nil(t, err, "Error should be nil")
+		}
+		assert.Nil(t, fake.Deliver(context.Background()), "Error should be nil when a function publishes to a topic without functions")
+		assert.Len(t, received, 2, "messages after the unsubscribed topic should be delivered")
+
+		if msgs := fake.Undelivered(""); assert.Len(t, msgs, 2, "Undelivered should contain the messages of the unsubscribed topic") {
+			assert.Equal(t, "analytics", msgs[0].Topic, "Topic should match")
+			assert.JSONEq(t, `{"email": "other@email.com"}`, string(msgs[0].Data), "Data should match")
+		}
+		assert.Empty(t, fake.Undelivered("orders"), "Undelivered should be filtered by topic")
+		assert.Len(t, fake.Messages(""), 4, "Messages should contain the undelivered messages")
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		srv := pstest.NewServer()
+		defer srv.Close()
+		conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("Error dialing the fake server: %v", err)
+		}
+		client, err := pubsub.NewClient(context.Background(), "my-project-id", option.WithGRPCConn(conn))
+		if err != nil {
+			t.Fatalf("Error creating the client: %v", err)
+		}
+		if _, err := client.CreateTopic(context.Background(), "orders"); err != nil {
+			t.Fatalf("Error creating the topic: %v", err)
+		}
+
+		pub := NewPublisher(NewRegister(), WrapPubSubClient(client))
+		defer pub.Close()
+
+		id, err := pub.Topic("orders").Attribute("event_type", "created").OrderingKey("customer-1").Publish(context.Background(), TestPubSubI{Email: "other@email.com"})
+		assert.Nil(t, err, "Error should be nil")
+		if m := srv.Message(id); assert.NotNil(t, m, "id should be the id of the published message") {
+			assert.JSONEq(t, `{"email": "other@email.com"}`, string(m.Data), "Data should match")
+			assert.Equal(t, map[string]string{"event_type": "created"}, m.Attributes, "Attributes should match")
+			assert.Equal(t, "customer-1", m.OrderingKey, "OrderingKey should match")
+		}
+
+		_, err = pub.Topic("missing").OrderingKey("customer-1").Publish(context.Background(), TestPubSubI{})
+		assert.NotNil(t, err, "Error should not be nil when the topic does not exist")
+		_, err = pub.Topic("orders").OrderingKey("customer-1").Publish(context.Background(), TestPubSubI{})
+		assert.Nil(t, err, "Error should be nil")
+		assert.Len(t, srv.Messages(), 2, "Messages should contain the published messages")
+
+		t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+		t.Setenv("GCP_PROJECT", "")
+		_, err = NewRegister().Publisher().Topic("orders").Publish(context.Background(), TestPubSubI{})
+		assert.NotNil(t, err, "Error should not be nil without a project")
+	})
+
+	t.Run("Emulator", func(t *testing.T) {
+		srv := pstest.NewServer()
+		defer srv.Close()
+		t.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+		t.Setenv("GOOGLE_CLOUD_PROJECT", "emulator-project")
+
+		reg := NewRegister()
+		reg.PubSub("audit").Codec(TextCodec).Publish("", nil)
+		pub := reg.Publisher()
+		defer pub.Close()
+
+		_, err := pub.Topic("audit").Publish(context.Background(), "hello emulator")
+		assert.NotNil(t, err, "Error should not be nil when the topic does not exist")
+
+		srv.GServer.CreateTopic(context.Background(), &pubsubpb.Topic{Name: "projects/emulator-project/topics/audit"})
+		id, err := pub.Topic("audit").Publish(context.Background(), "hello emulator")
+		assert.Nil(t, err, "Error should be nil")
+		if m := srv.Message(id); assert.NotNil(t, m, "message should be published to the emulator") {
+			assert.Equal(t, "hello emulator", string(m.Data), "Data should be encoded by the codec of the function")
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package register
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// PushSubscription registers a route receiving the messages of a Pub/Sub push subscription of the topic
+// The messages are dispatched to the PubSubFunction registered to the topic, which is then served by HttpEntrypoint
+// and excluded from the deployed background functions. The route only accepts POST requests
+//
+//	f.PushSubscription("/push/orders", "orders").VerifyOIDC("https://REGION-PROJECT_ID.cloudfunctions.net/Registrar/push/orders")
+//	f.PubSub("orders").Publish(Order{}, onOrder)
+//
+// Responds 200 to acknowledge the message, any other status is a negative acknowledgement and the message is redelivered:
+// 401 when the token fails verification & 500 when the PubSubFunc fails. Requests that are not push messages
+// & messages that do not decode into the registered type are logged & acknowledged, as redelivering them cannot succeed, see ErrPubSubDecode
+func (f *FunctionRegistrar) PushSubscription(path, topic string) *PushSubscription {
+	p := &PushSubscription{
+		fn:   f.PubSub(topic),
+		keys: GoogleKeySource,
+	}
+	p.fn.push = true
+	p.HttpFunction = f.HTTP(path, p.ServeHTTP).Methods(http.MethodPost)
+
+	return p
+}
+
+// PushSubscription is the HttpFunction of a push subscription, see FunctionRegistrar.PushSubscription
+type PushSubscription struct {
+	*HttpFunction
+	fn *PubSubFunction
+
+	verify   bool      // verify the OIDC token of the request
+	audience string    // expected audience of the token
+	email    string    // expected service account of the token, any when empty
+	keys     KeySource // verifies the signature of the token
+}
+
+// pushEnvelope is the body of push requests: {"message": {"data": "<base64>", "attributes": {...}, ...}, "subscription": "..."}
+// the message is decoded by PubSubFunction.HandleCloudEvent as it is for background functions
+type pushEnvelope struct {
+	Message      json.RawMessage `json:"message"`
+	Subscription string          `json:"subscription"`
+}
+
+// VerifyOIDC requires requests to be authenticated with an OIDC token for the audience, as configured on the push subscription
+// The signature is verified with the keys of GoogleKeySource unless set with Keys
+func (p *PushSubscription) VerifyOIDC(audience string) *PushSubscription {
+	p.verify = true
+	p.audience = audience
+	return p
+}
+
+// ServiceAccount requires the OIDC token to be issued to the service account email, see VerifyOIDC
+func (p *PushSubscription) ServiceAccount(email string) *PushSubscription {
+	p.email = email
+	return p
+}
+
+// Keys sets the KeySource verifying the signature of the OIDC token, see VerifyOIDC
+func (p *PushSubscription) Keys(k KeySource) *PushSubscription {
+	p.keys = k
+	return p
+}
+
+// Topic returns the topic of the subscription
+func (p *PushSubscription) Topic() string {
+	return p.fn.resource
+}
+
+// ServeHTTP verifies & decodes the push request, then calls the PubSubFunction of the topic
+func (p *PushSubscription) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.verify {
+		token, ok := bearerToken(r)
+		if !ok {
+			Debug.Msgf("push subscription [%s]: unauthorized: missing bearer token", p.Topic())
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, err := verifyOIDCToken(r.Context(), token, p.keys, p.audience, p.email); err != nil {
+			Debug.Msgf("push subscription [%s]: unauthorized: %s", p.Topic(), err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// redelivering a request that does not decode cannot succeed, it is acknowledged
+	var push pushEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		Error.Msgf("push subscription [%s]: acknowledged undecodable request: %s", p.Topic(), err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if len(push.Message) == 0 {
+		Error.Msgf("push subscription [%s]: acknowledged request without a message: %s", p.Topic(), push.Subscription)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var msg struct {
+		MessageID   string    `json:"messageId"`
+		PublishTime time.Time `json:"publishTime"`
+	}
+	if err := json.Unmarshal(push.Message, &msg); err != nil {
+		Error.Msgf("push subscription [%s]: acknowledged undecodable message: %s: %s", p.Topic(), err, string(push.Message))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// the project of the topic is that of the subscription: projects/{project}/subscriptions/{subscription}
+	project := strings.TrimPrefix(push.Subscription, "projects/")
+	if i := strings.Index(project, "/"); i >= 0 {
+		project = project[:i]
+	}
+
+	md := &metadata.Metadata{
+		EventID:   msg.MessageID,
+		Timestamp: msg.PublishTime,
+		EventType: string(PubSubPublishEvent),
+		Resource: &metadata.Resource{
+			Service: "pubsub.googleapis.com",
+			Name:    fmt.Sprintf("projects/%s/topics/%s", project, p.Topic()),
+			Type:    "type.googleapis.com/google.pubsub.v1.PubsubMessage",
+		},
+	}
+
+	err := p.fn.HandleCloudEvent(metadata.NewContext(r.Context(), md), md, &Decoder{data: push.Message})
+	if errors.Is(err, ErrPubSubDecode) {
+		Error.Msgf("push subscription [%s]: acknowledged undecodable message %s: %s", p.Topic(), msg.MessageID, err)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// bearerToken returns the token of the Authorization header, false unless the header has the Bearer scheme
+func bearerToken(r *http.Request) (string, bool) {
+	const scheme = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return "", false
+	}
+	return auth[len(scheme):], true
+}
@@ -0,0 +1,281 @@
+package register
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushSubscription(t *testing.T) {
+	// push returns a push request for the message data & attributes
+	push := func(data string, attrs string) *http.Request {
+		body := fmt.Sprintf(`{"message": {"data": "%s", "attributes": %s, "messageId": "2070443601311540", "message_id": "2070443601311540", "publishTime": "2021-02-26T19:13:55.749Z", "publish_time": "2021-02-26T19:13:55.749Z"}, "subscription": "projects/my-project-id/subscriptions/orders-push"}`,
+			base64.StdEncoding.EncodeToString([]byte(data)), attrs)
+		return httptest.NewRequest(http.MethodPost, "/push/orders", strings.NewReader(body))
+	}
+
+	t.Run("Dispatch", func(t *testing.T) {
+		reg := NewRegister()
+		var msg PubSubMessage
+		var md *metadata.Metadata
+		reg.PushSubscription("/push/orders", "orders")
+		onStatus := func(ctx context.Context, m PubSubMessage) error {
+			msg = m
+			return nil
+		}
+		onOrder := func(ctx context.Context, m PubSubMessage) error {
+			msg = m
+			md, _ = metadata.FromContext(ctx)
+			if m.Data.(*TestPubSubI).Email == "" {
+				return fmt.Errorf("missing email")
+			}
+			return nil
+		}
+		reg.PubSub("orders").
+			When("event_type", "status").Codec(TextCodec).Publish(TestPubSubStatus(""), onStatus).
+			Publish(TestPubSubI{}, onOrder)
+
+		w := httptest.NewRecorder()
+		reg.HttpEntrypoint(w, push(`{"email": "other@email.com"}`, `{"event_type": "created"}`))
+		assert.Equal(t, http.StatusOK, w.Code, "message should be acknowledged: %s", w.Body)
+		assert.Equal(t, &TestPubSubI{Email: "other@email.com"}, msg.Data, "Data should be decoded")
+		assert.Equal(t, "orders", msg.Topic, "Topic should match")
+		assert.Equal(t, map[string]string{"event_type": "created"}, msg.Attributes, "Attributes should match")
+		assert.Equal(t, "2070443601311540", msg.MessageID, "MessageID should match")
+		assert.Equal(t, time.Date(2021, 2, 26, 19, 13, 55, 749000000, time.UTC), msg.PublishTime, "PublishTime should match")
+		if assert.NotNil(t, md, "context should contain the metadata") {
+			assert.Equal(t, "projects/my-project-id/topics/orders", md.Resource.Name, "Resource should be the topic of the subscription")
+		}
+
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, push("shipped", `{"event_type": "status"}`))
+		assert.Equal(t, http.StatusOK, w.Code, "message should be acknowledged: %s", w.Body)
+		assert.Equal(t, TestPubSubStatus("shipped"), *msg.Data.(*TestPubSubStatus), "Data should be decoded by the branch")
+
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, push(`{}`, `{}`))
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "message should not be acknowledged when the PubSubFunc fails")
+
+		msg = PubSubMessage{}
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, push(`not json`, `{}`))
+		assert.Equal(t, http.StatusOK, w.Code, "message should be acknowledged when the data does not decode: %s", w.Body)
+		assert.Nil(t, msg.Data, "PubSubFunc should not be called")
+
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, httptest.NewRequest(http.MethodPost, "/push/orders", strings.NewReader(`{"message": {"messageId": 1}, "subscription": "projects/my-project-id/subscriptions/orders-push"}`)))
+		assert.Equal(t, http.StatusOK, w.Code, "message should be acknowledged when it does not decode: %s", w.Body)
+		assert.Nil(t, msg.Data, "PubSubFunc should not be called")
+
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, httptest.NewRequest(http.MethodPost, "/push/orders", strings.NewReader(`{"subscription": "projects/my-project-id/subscriptions/orders-push"}`)))
+		assert.Equal(t, http.StatusOK, w.Code, "request without a message should be acknowledged: %s", w.Body)
+		assert.Nil(t, msg.Data, "PubSubFunc should not be called")
+
+		w = httptest.NewRecorder()
+		reg.HttpEntrypoint(w, httptest.NewRequest(http.MethodPost, "/push/orders", strings.NewReader(`not json`)))
+		assert.Equal(t, http.StatusOK, w.Code, "invalid request should be acknowledged: %s", w.Body)
+		assert.Nil(t, msg.Data, "PubSubFunc should not be called")
+	})
+
+	t.Run("Deploy", func(t *testing.T) {
+		reg := NewRegister()
+		reg.PushSubscription("/push/orders", "orders")
+		reg.PubSub("orders").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error { return nil })
+		reg.PubSub("audit").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error { return nil })
+
+		assert.Nil(t, reg.Validate(), "Error should be nil")
+		cmd := reg.Deploy()
+		assert.NotContains(t, cmd, "pubsub-publish-orders", "push topics should not be deployed as background functions")
+		assert.Contains(t, cmd, "pubsub-publish-audit", "other topics should be deployed")
+		assert.Contains(t, cmd, "--trigger-http", "the push route should be deployed with the http functions")
+		assert.NotContains(t, reg.DeployTerraform(), "pubsub-publish-orders", "push topics should not be deployed as background functions")
+
+		reg.PushSubscription("/push/payments", "payments")
+		var ve *ValidationError
+		if assert.True(t, errors.As(reg.Validate(), &ve), "Error should be *ValidationError") && assert.Len(t, ve.Errors, 1, "Errors should contain the topic without a handler") {
+			assert.True(t, errors.Is(ve.Errors[0], ErrNilHandler), "Error should be ErrNilHandler: %s", ve.Errors[0])
+		}
+	})
+
+	t.Run("OIDC", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.Nil(t, err, "Error should be nil") {
+			return
+		}
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.Nil(t, err, "Error should be nil") {
+			return
+		}
+		keys := KeySourceFunc(func(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+			if kid != "test-key" {
+				return nil, fmt.Errorf("unknown key id %q", kid)
+			}
+			return &key.PublicKey, nil
+		})
+
+		audience := "https://example.com/push/orders"
+		claims := func(aud string, exp time.Time, email string) map[string]interface{} {
+			return map[string]interface{}{"iss": "https://accounts.google.com", "aud": aud, "exp": exp.Unix(), "iat": time.Now().Unix(), "email": email, "email_verified": true}
+		}
+		valid := claims(audience, time.Now().Add(time.Hour), "push@my-project-id.iam.gserviceaccount.com")
+		// with returns the valid claims with the claim set, or removed when nil
+		with := func(claim string, v interface{}) map[string]interface{} {
+			c := claims(audience, time.Now().Add(time.Hour), "push@my-project-id.iam.gserviceaccount.com")
+			c[claim] = v
+			if v == nil {
+				delete(c, claim)
+			}
+			return c
+		}
+
+		reg := NewRegister()
+		called := 0
+		reg.PubSub("orders").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+			called++
+			return nil
+		})
+		reg.PushSubscription("/push/orders", "orders").VerifyOIDC(audience).ServiceAccount("push@my-project-id.iam.gserviceaccount.com").Keys(keys)
+
+		tests := []struct {
+			name   string
+			token  string
+			status int
+		}{
+			{"Valid", signTestToken(t, key, "test-key", valid), http.StatusOK},
+			{"Missing", "", http.StatusUnauthorized},
+			{"Malformed", "not.a-token", http.StatusUnauthorized},
+			{"Unknown Key", signTestToken(t, key, "other-key", valid), http.StatusUnauthorized},
+			{"Invalid Signature", signTestToken(t, other, "test-key", valid), http.StatusUnauthorized},
+			{"Audience", signTestToken(t, key, "test-key", claims("https://example.com/other", time.Now().Add(time.Hour), "push@my-project-id.iam.gserviceaccount.com")), http.StatusUnauthorized},
+			{"Expired", signTestToken(t, key, "test-key", claims(audience, time.Now().Add(-time.Hour), "push@my-project-id.iam.gserviceaccount.com")), http.StatusUnauthorized},
+			{"Service Account", signTestToken(t, key, "test-key", claims(audience, time.Now().Add(time.Hour), "other@my-project-id.iam.gserviceaccount.com")), http.StatusUnauthorized},
+			{"Clock Skew", signTestToken(t, key, "test-key", with("iat", time.Now().Add(30*time.Second).Unix())), http.StatusOK},
+			{"Issued In The Future", signTestToken(t, key, "test-key", with("iat", time.Now().Add(10*time.Minute).Unix())), http.StatusUnauthorized},
+			{"Missing Issue Time", signTestToken(t, key, "test-key", with("iat", nil)), http.StatusUnauthorized},
+			{"Not Before", signTestToken(t, key, "test-key", with("nbf", time.Now().Add(10*time.Minute).Unix())), http.StatusUnauthorized},
+			{"Valid Not Before", signTestToken(t, key, "test-key", with("nbf", time.Now().Add(-time.Minute).Unix())), http.StatusOK},
+			{"Lifetime", signTestToken(t, key, "test-key", with("exp", time.Now().Add(24*time.Hour).Unix())), http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				called = 0
+				r := push(`{"email": "other@email.com"}`, `{}`)
+				if tt.token != "" {
+					r.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				w := httptest.NewRecorder()
+				reg.HttpEntrypoint(w, r)
+				assert.Equal(t, tt.status, w.Code, "status should match: %s", w.Body)
+				if tt.status == http.StatusOK {
+					assert.Equal(t, 1, called, "PubSubFunc should be called")
+				} else {
+					assert.Equal(t, 0, called, "PubSubFunc should not be called")
+				}
+			})
+		}
+
+		t.Run("Scheme", func(t *testing.T) {
+			called = 0
+			for _, auth := range []string{signTestToken(t, key, "test-key", valid), "Basic " + signTestToken(t, key, "test-key", valid), "Bearer "} {
+				r := push(`{"email": "other@email.com"}`, `{}`)
+				r.Header.Set("Authorization", auth)
+				w := httptest.NewRecorder()
+				reg.HttpEntrypoint(w, r)
+				assert.Equal(t, http.StatusUnauthorized, w.Code, "status should match for %.10q: %s", auth, w.Body)
+			}
+			assert.Equal(t, 0, called, "PubSubFunc should not be called")
+
+			r := push(`{"email": "other@email.com"}`, `{}`)
+			r.Header.Set("Authorization", "bearer "+signTestToken(t, key, "test-key", valid))
+			w := httptest.NewRecorder()
+			reg.HttpEntrypoint(w, r)
+			assert.Equal(t, http.StatusOK, w.Code, "scheme should be case-insensitive: %s", w.Body)
+		})
+	})
+
+	t.Run("JWKS", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if !assert.Nil(t, err, "Error should be nil") {
+			return
+		}
+		fetched := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetched++
+			if fetched > 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		}))
+		defer srv.Close()
+
+		jwks := NewJWKSKeySource(srv.URL)
+		pub, err := jwks.PublicKey(context.Background(), "test-key")
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, key.PublicKey.Equal(pub), "key should match")
+
+		_, err = jwks.PublicKey(context.Background(), "test-key")
+		assert.Nil(t, err, "Error should be nil")
+		_, err = jwks.PublicKey(context.Background(), "unknown")
+		assert.NotNil(t, err, "Error should not be nil for an unknown key")
+		assert.Equal(t, 1, fetched, "keys should be cached")
+
+		// expire the keys, the refresh fails
+		jwks.fetched = jwks.fetched.Add(-2 * jwksRefresh)
+		jwks.attempted = jwks.fetched
+		pub, err = jwks.PublicKey(context.Background(), "test-key")
+		assert.Nil(t, err, "Error should be nil when the refresh of a cached key fails")
+		assert.True(t, key.PublicKey.Equal(pub), "key should be the cached key")
+		assert.Equal(t, 2, fetched, "keys should be fetched again once expired")
+		_, err = jwks.PublicKey(context.Background(), "test-key")
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, 2, fetched, "failed fetches should only be retried once a minute")
+
+		jwks.attempted = jwks.attempted.Add(-2 * jwksRetry)
+		_, err = jwks.PublicKey(context.Background(), "unknown")
+		if assert.NotNil(t, err, "Error should not be nil for an unknown key") {
+			assert.Contains(t, err.Error(), "failed to fetch keys", "Error should be the failed fetch")
+		}
+		assert.Equal(t, 3, fetched, "unknown keys should be fetched")
+
+		token := signTestToken(t, key, "test-key", map[string]interface{}{"iss": "accounts.google.com", "aud": "push", "exp": time.Now().Add(time.Hour).Unix(), "iat": time.Now().Unix()})
+		_, err = verifyOIDCToken(context.Background(), token, jwks, "push", "")
+		assert.Nil(t, err, "Error should be nil")
+	})
+}
+
+// signTestToken returns a RS256 JWT of the claims signed with the key
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	assert.Nil(t, err, "Error should be nil")
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err, "Error should be nil")
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.Nil(t, err, "Error should be nil")
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
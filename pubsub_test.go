@@ -2,13 +2,17 @@ package register
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/functions/metadata"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 type TestPubSubI struct {
@@ -19,10 +23,11 @@ func TestPubSub(t *testing.T) {
 	reg := NewRegister()
 	testmd := metadata.NewContext(context.Background(), &metadata.Metadata{
 		EventType: string(PubSubPublishEvent),
+		Resource:  &metadata.Resource{Service: "pubsub.googleapis.com", Name: "projects/my-project-id/topics/test-topic"},
 	})
 
 	testDec := &Decoder{}
-	err := json.Unmarshal([]byte(`{"topic": "test-topic", "email": "other@email.com"}`), testDec)
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{"@type": "type.googleapis.com/google.pubsub.v1.PubsubMessage", "data": "%s"}`, base64.StdEncoding.EncodeToString([]byte(`{"email": "other@email.com"}`)))), testDec)
 	if err != nil {
 		t.Errorf("Error unmarshalling test pubsub data: %v", err)
 	}
@@ -44,7 +49,7 @@ func TestPubSub(t *testing.T) {
 		ps := reg.PubSub("test-topic").Publish(TestPubSubI{}, testPubSubFunc)
 
 		assert.Same(t, ps, reg.PubSub("test-topic"), "PubSub function should be registered")
-		assert.Same(t, ps, reg.events[fmt.Sprintf("%s-%s", PubSubPublishEvent, "test-topic")], "PubSub function should be registered")
+		assert.Same(t, ps, reg.events[eventKey(PubSubPublishEvent.Type(), "test-topic")], "PubSub function should be registered")
 		assert.NotNil(t, ps.fn, "PubSub function should be equal not nil")
 
 		t.Log("PubSub Function registered for UserCreateEvent")
@@ -61,6 +66,7 @@ func TestPubSub(t *testing.T) {
 
 	errmd := metadata.NewContext(context.Background(), &metadata.Metadata{
 		EventType: string(PubSubPublishEvent),
+		Resource:  &metadata.Resource{Service: "pubsub.googleapis.com", Name: "projects/my-project-id/topics/non-topic"},
 	})
 
 	testPubSubErrFunc := func(ctx context.Context, e PubSubMessage) error {
@@ -68,7 +74,7 @@ func TestPubSub(t *testing.T) {
 	}
 
 	testerrDec := &Decoder{}
-	err = json.Unmarshal([]byte(`{"topic": "non-topic", "email": "other@email.com"}`), testerrDec)
+	err = json.Unmarshal([]byte(fmt.Sprintf(`{"@type": "type.googleapis.com/google.pubsub.v1.PubsubMessage", "data": "%s"}`, base64.StdEncoding.EncodeToString([]byte(`{"email": "other@email.com"}`)))), testerrDec)
 	if err != nil {
 		t.Errorf("Error unmarshalling test pubsub data: %v", err)
 	}
@@ -82,4 +88,221 @@ func TestPubSub(t *testing.T) {
 		assert.NotNilf(t, err, "PubSub function error should be nil: %s", err)
 	})
 
+	t.Run("Routing", func(t *testing.T) {
+		reg := NewRegister()
+		called := map[string]int{}
+		for _, topic := range []string{"orders", "orders-dlq"} {
+			topic := topic
+			reg.PubSub(topic).Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+				called[topic]++
+				assert.Equal(t, topic, m.Topic, "Topic should match")
+				return nil
+			})
+		}
+
+		// 1st gen functions receive the metadata as JSON, the resource may be an object or a string
+		for _, resource := range []string{
+			`{"service": "pubsub.googleapis.com", "name": "projects/my-project-id/topics/orders", "type": "type.googleapis.com/google.pubsub.v1.PubsubMessage"}`,
+			`"projects/my-project-id/topics/orders-dlq"`,
+		} {
+			md := &metadata.Metadata{}
+			err := json.Unmarshal([]byte(fmt.Sprintf(`{"eventId": "4203521185498837", "timestamp": "2022-03-14T09:26:53.000Z", "eventType": "google.pubsub.topic.publish", "resource": %s}`, resource)), md)
+			assert.Nil(t, err, "Error should be nil")
+
+			err = reg.EntryPoint(metadata.NewContext(context.Background(), md), testDec)
+			assert.Nil(t, err, "Error should be nil")
+		}
+		assert.Equal(t, map[string]int{"orders": 1, "orders-dlq": 1}, called, "each topic should be routed by the resource")
+
+		events := len(reg.events)
+		err := reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{
+			EventType: string(PubSubPublishEvent),
+			Resource:  &metadata.Resource{Name: "projects/my-project-id/topics/unknown"},
+		}), testDec)
+		if assert.NotNil(t, err, "Error should not be nil for a topic without a subscriber") {
+			assert.Contains(t, err.Error(), "no PubSubFunc registered", "Error should describe the missing subscriber")
+		}
+		assert.Nil(t, reg.findPubSub("unknown"), "PubSub function should not be registered")
+		assert.Len(t, reg.events, events, "EntryPoint should not register functions")
+
+		err = reg.EntryPoint(metadata.NewContext(context.Background(), &metadata.Metadata{EventType: string(PubSubPublishEvent)}), testDec)
+		assert.NotNil(t, err, "Error should not be nil without a resource")
+	})
+}
+
+type TestPubSubStatus string
+
+func TestPubSubEnvelope(t *testing.T) {
+	publishTime := time.Date(2022, 3, 14, 9, 26, 53, 0, time.UTC)
+	md := &metadata.Metadata{
+		EventID:   "4203521185498837",
+		Timestamp: publishTime,
+		EventType: string(PubSubPublishEvent),
+		Resource: &metadata.Resource{
+			Service: "pubsub.googleapis.com",
+			Name:    "projects/my-project-id/topics/test-topic",
+			Type:    "type.googleapis.com/google.pubsub.v1.PubsubMessage",
+		},
+	}
+
+	// envelope returns the payload delivered to background functions with the data base64 encoded
+	envelope := func(data []byte, fields string) *Decoder {
+		return &Decoder{data: []byte(fmt.Sprintf(`{"@type": "type.googleapis.com/google.pubsub.v1.PubsubMessage", "data": "%s"%s}`, base64.StdEncoding.EncodeToString(data), fields))}
+	}
+
+	t.Run("Metadata", func(t *testing.T) {
+		var msg PubSubMessage
+		ps := NewRegister().PubSub("test-topic").Publish(TestPubSubI{}, func(ctx context.Context, m PubSubMessage) error {
+			msg = m
+			return nil
+		})
+
+		err := ps.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "other@email.com"}`), `, "attributes": {"event_type": "created"}`))
+		assert.Nil(t, err, "Error should be nil")
+		if assert.IsType(t, &TestPubSubI{}, msg.Data, "Data should be of type TestPubSubI") {
+			assert.Equal(t, "other@email.com", msg.Data.(*TestPubSubI).Email, "Email should be decoded from the base64 data")
+		}
+		assert.Equal(t, "test-topic", msg.Topic, "Topic should match")
+		assert.Equal(t, map[string]string{"event_type": "created"}, msg.Attributes, "Attributes should be decoded")
+		assert.Equal(t, "4203521185498837", msg.MessageID, "MessageID should be set from the metadata")
+		assert.Equal(t, publishTime, msg.PublishTime, "PublishTime should be set from the metadata")
+		assert.Equal(t, "", msg.OrderingKey, "OrderingKey should be empty")
+
+		err = ps.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "other@email.com"}`), `, "messageId": "5", "publishTime": "2022-03-15T10:00:00Z", "orderingKey": "customer-1"`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "5", msg.MessageID, "MessageID should be decoded from the message")
+		assert.Equal(t, time.Date(2022, 3, 15, 10, 0, 0, 0, time.UTC), msg.PublishTime, "PublishTime should be decoded from the message")
+		assert.Equal(t, "customer-1", msg.OrderingKey, "OrderingKey should be decoded from the message")
+	})
+
+	t.Run("Codecs", func(t *testing.T) {
+		reg := NewRegister()
+		var msg PubSubMessage
+		capture := func(ctx context.Context, m PubSubMessage) error {
+			msg = m
+			return nil
+		}
+
+		raw := reg.PubSub("raw").Codec(RawCodec).Publish([]byte{}, capture)
+		err := raw.HandleCloudEvent(context.Background(), md, envelope([]byte{0x00, 0xff, 0x10}, ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, &[]byte{0x00, 0xff, 0x10}, msg.Data, "Data should be the raw bytes")
+
+		text := reg.PubSub("text").Codec(TextCodec).Publish("", capture)
+		err = text.HandleCloudEvent(context.Background(), md, envelope([]byte("hello world"), ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "hello world", *msg.Data.(*string), "Data should be the text")
+
+		status := reg.PubSub("status").Codec(TextCodec).Publish(TestPubSubStatus(""), capture)
+		err = status.HandleCloudEvent(context.Background(), md, envelope([]byte("shipped"), ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, TestPubSubStatus("shipped"), *msg.Data.(*TestPubSubStatus), "Data should be the text")
+
+		b, err := proto.Marshal(wrapperspb.String("hello proto"))
+		assert.Nil(t, err, "Error should be nil")
+		pb := reg.PubSub("proto").Codec(ProtoCodec).Publish(&wrapperspb.StringValue{}, capture)
+		err = pb.HandleCloudEvent(context.Background(), md, envelope(b, ""))
+		assert.Nil(t, err, "Error should be nil")
+		if v, ok := msg.Data.(*wrapperspb.StringValue); assert.True(t, ok, "Data should be of type *wrapperspb.StringValue: %T", msg.Data) {
+			assert.Equal(t, "hello proto", v.GetValue(), "Data should be decoded from protobuf")
+		}
+
+		ptr := reg.PubSub("pointer").Publish(&TestPubSubI{}, capture)
+		err = ptr.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "other@email.com"}`), ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, &TestPubSubI{Email: "other@email.com"}, msg.Data, "Data registered as a pointer should be decoded as *T")
+
+		untyped := reg.PubSub("untyped").Publish(nil, capture)
+		err = untyped.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "other@email.com"}`), ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []byte(`{"email": "other@email.com"}`), msg.Data, "Data registered as nil should be the raw bytes")
+
+		ps := reg.PubSub("json").Publish(TestPubSubI{}, capture)
+		err = ps.HandleCloudEvent(context.Background(), md, envelope(nil, `, "attributes": {"empty": "true"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, &TestPubSubI{}, msg.Data, "Data should be the zero value when the message has no data")
+
+		msg = PubSubMessage{}
+		err = ps.HandleCloudEvent(context.Background(), md, envelope([]byte("not json"), ""))
+		assert.NotNil(t, err, "Error should not be nil when the data does not decode")
+		assert.Nil(t, msg.Data, "PubSubFunc should not be called")
+	})
+
+	t.Run("Branches", func(t *testing.T) {
+		reg := NewRegister()
+		var called string
+		var msg PubSubMessage
+		capture := func(name string) PubSubFunc {
+			return func(ctx context.Context, m PubSubMessage) error {
+				called, msg = name, m
+				return nil
+			}
+		}
+
+		ps := reg.PubSub("test-topic").
+			When("event_type", "created").Publish(TestPubSubI{}, capture("created")).
+			When("event_type", "status").Codec(TextCodec).Publish(TestPubSubStatus(""), capture("status")).
+			WhenFunc(func(m PubSubMessage) bool { return m.Attributes["priority"] == "high" }).Publish(map[string]interface{}{}, capture("priority")).
+			Publish(TestPubSubI{}, capture("default"))
+
+		assert.Len(t, reg.registered, 1, "branches should share the function of the topic")
+		assert.Equal(t, "pubsub-publish-test-topic", ps.Name(), "Name should match")
+
+		err := ps.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "other@email.com"}`), `, "attributes": {"event_type": "created", "priority": "high"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "created", called, "first matching branch should be called")
+		if assert.IsType(t, &TestPubSubI{}, msg.Data, "Data should be of type TestPubSubI") {
+			assert.Equal(t, "other@email.com", msg.Data.(*TestPubSubI).Email, "Email should be decoded from the base64 data")
+		}
+
+		err = ps.HandleCloudEvent(context.Background(), md, envelope([]byte("shipped"), `, "attributes": {"event_type": "status"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "status", called, "matching branch should be called")
+		assert.Equal(t, TestPubSubStatus("shipped"), *msg.Data.(*TestPubSubStatus), "Data should be decoded by the codec of the branch")
+
+		err = ps.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"total": 5}`), `, "attributes": {"event_type": "deleted", "priority": "high"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "priority", called, "predicate branch should be called")
+		assert.Equal(t, &map[string]interface{}{"total": 5.0}, msg.Data, "Data should be decoded by the codec of the function")
+
+		err = ps.HandleCloudEvent(context.Background(), md, envelope([]byte(`{"email": "default@email.com"}`), ""))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "default", called, "default branch should be called")
+		assert.Equal(t, &TestPubSubI{Email: "default@email.com"}, msg.Data, "Data should be decoded into the type of the default branch")
+
+		called = ""
+		noDefault := reg.PubSub("no-default").When("event_type", "created").Publish(TestPubSubI{}, capture("created"))
+		err = noDefault.HandleCloudEvent(context.Background(), md, envelope([]byte("not json"), `, "attributes": {"event_type": "deleted"}`))
+		assert.Nil(t, err, "Error should be nil when no branch matches")
+		assert.Equal(t, "", called, "PubSubFunc should not be called")
+		assert.Nil(t, reg.Validate(), "branches without a default should be valid")
+
+		msg = PubSubMessage{}
+		untyped := reg.PubSub("untyped").When("event_type", "created").Publish(nil, capture("untyped"))
+		err = untyped.HandleCloudEvent(context.Background(), md, envelope([]byte("not json"), `, "attributes": {"event_type": "created"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "untyped", called, "branch registered with nil data should be called")
+		assert.Equal(t, []byte("not json"), msg.Data, "Data registered as nil should be the raw bytes")
+
+		reg.PubSub("nil-branch").When("event_type", "created")
+		var ve *ValidationError
+		if assert.True(t, errors.As(reg.Validate(), &ve), "Error should be *ValidationError") && assert.Len(t, ve.Errors, 1, "Errors should contain the branch without a handler") {
+			assert.True(t, errors.Is(ve.Errors[0], ErrNilHandler), "Error should be ErrNilHandler: %s", ve.Errors[0])
+		}
+	})
+
+	t.Run("Marshal", func(t *testing.T) {
+		b, err := JSONCodec.Marshal(TestPubSubI{Email: "other@email.com"})
+		assert.Nil(t, err, "Error should be nil")
+		assert.JSONEq(t, `{"email": "other@email.com"}`, string(b), "JSON should match")
+
+		b, err = TextCodec.Marshal(TestPubSubStatus("shipped"))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, []byte("shipped"), b, "text should match")
+
+		_, err = RawCodec.Marshal("not bytes")
+		assert.NotNil(t, err, "Error should not be nil")
+		_, err = ProtoCodec.Marshal(TestPubSubI{})
+		assert.NotNil(t, err, "Error should not be nil")
+	})
 }
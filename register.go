@@ -3,6 +3,7 @@ package register
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"cloud.google.com/go/functions/metadata"
 	"github.com/gorilla/mux"
@@ -34,6 +35,7 @@ func (d *Decoder) Decode(v interface{}) error {
 type FunctionRegistrar struct {
 	http     *mux.Router // mapped by route
 	handlers map[string]*HttpFunction
+	paths    []string // paths of the handlers in registration order, see httpOptions
 
 	// authentication map[AuthEventType]*AuthenticationFunction              // mapped by event type
 	firestore  map[FirestoreEventType]map[string]*FirestoreFunction   // mapped by event type & path
@@ -46,13 +48,19 @@ type FunctionRegistrar struct {
 	// remoteConfig map[RemoteConfigEventType]*RemoteConfigFunction // mapped by event type
 	// scheduler    map[string]*SchedulerFunction                   // mapped by event type
 
-	events    map[string]CloudDeployFunction // pointers to all functions with a generated name
-	projectID string
-	registrar string
-	verbosity VerbosityLevel
-	runtime   Runtime
+	events     map[string]CloudDeployFunction // pointers to all functions mapped by trigger, see eventKey
+	registered []registeredFunction           // every registered function in order, including those replaced in events, see Validate
+	projectID  string
+	registrar  string
+	verbosity  VerbosityLevel
+	runtime    Runtime
+	naming     NamingStrategy    // generates the names of the functions, DefaultNaming when nil
+	names      map[string]string // names of the deployed functions cached by functionNames, reset when a function is registered or named
+	options    deployOptions     // defaults for all functions, overridden by the options set on each function
 
 	httpUnauthenticated bool
+	gen2                bool
+	aggregateErrors     bool // run every handler of a trigger and aggregate the errors, see AggregateErrors
 }
 
 // NewRegister creates a new registrar with all top level maps initialized
@@ -89,27 +97,32 @@ func (f *FunctionRegistrar) EntryPoint(ctx context.Context, dec *Decoder) error
 			return Debug.Errf("no FirestoreFunc registered for [%s]: %s", md.EventType, md.Resource.RawPath)
 		}
 
-		fsFunc.HandleCloudEvent(ctx, md, dec)
+		if err := fsFunc.HandleCloudEvent(ctx, md, dec); err != nil {
+			return Debug.Err("failed to handle cloud event", err)
+		}
 
 		return nil
 
 	case AuthEventType(md.EventType).Valid():
-		if c, ok := f.findEvent(AuthEventType(md.EventType).String()); ok {
+		if c, ok := f.findEvent(eventKey(AuthEventType(md.EventType).Type(), "")); ok {
 			err = c.HandleCloudEvent(ctx, md, dec)
 			if err != nil {
-				return Debug.Errf("registered authFunc failed [%s]: %s: AuthFunc %+v", md.EventType, err, c)
+				return Debug.Errf("registered authFunc failed [%s]: %w: AuthFunc %+v", md.EventType, err, c)
 			}
 		}
 
 		return nil
 	case PubSubEventType(md.EventType).Valid():
-		var m PubSubMessage
-		err = dec.Decode(&m)
-		if err != nil {
-			return Debug.Errf("failed to decode topic [%s]: %s: %s", md.EventType, err, string(dec.data))
+		if md.Resource == nil {
+			return Debug.Errf("no topic for [%s]: metadata has no resource", md.EventType)
+		}
+
+		topic := pubsubTopic(md.Resource)
+		pubFunc := f.findPubSub(topic)
+		if pubFunc == nil {
+			return Debug.Errf("no PubSubFunc registered for [%s]: %s", md.EventType, topic)
 		}
 
-		pubFunc := f.PubSub(m.Topic)
 		if err := pubFunc.HandleCloudEvent(ctx, md, dec); err != nil {
 			return Debug.Err("failed to handle cloud event", err)
 		}
@@ -135,11 +148,28 @@ func (f *FunctionRegistrar) EntryPoint(ctx context.Context, dec *Decoder) error
 	return Debug.Errf("registrar closed without any results: event type did not decode: %s: %s", md.EventType, string(dec.data))
 }
 
-// Find locates a registered function by name.
-func (f *FunctionRegistrar) findEvent(name string) (CloudDeployFunction, bool) {
-	if v, ok := f.events[name]; ok {
+// Find locates a registered function by its key, see eventKey
+func (f *FunctionRegistrar) findEvent(key string) (CloudDeployFunction, bool) {
+	if v, ok := f.events[key]; ok {
 		return v, ok
 	}
 
 	return nil, false
 }
+
+// addEvent saves the function by the event & route of its trigger, a function registered to the same trigger replaces the previous one
+// every registered function is kept so that Validate can report the replaced functions
+func (f *FunctionRegistrar) addEvent(route string, fn registeredFunction) {
+	key := eventKey(fn.Event(), route)
+	fn.deployer().key = key
+
+	f.registered = append(f.registered, fn)
+	f.events[key] = fn
+	f.names = nil
+}
+
+// eventKey returns the key of a function in FunctionRegistrar.events: "{event type} {route}"
+// the route is the registered path of Firestore & RealtimeDB functions, the bucket or topic, empty for authentication
+func eventKey(event EventType, route string) string {
+	return fmt.Sprintf("%s %s", event, route)
+}
@@ -3,7 +3,6 @@ package register
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"path"
 	"reflect"
 	"strings"
@@ -18,6 +17,7 @@ const (
 // RealtimeDB returns a new RealtimeDBFunction with the FunctionRegistrar set to the parent
 func (f *FunctionRegistrar) RealtimeDB() *RealtimeDBFunction {
 	s := &RealtimeDBFunction{reg: f}
+	s.target = s
 	return s
 }
 
@@ -51,11 +51,9 @@ func (r *RealtimeDBFunction) Path() string {
 
 	pathParts := strings.Split(r.resource, "/")
 	for i, part := range pathParts {
-		if match := wildcardRegexp.MatchString(part); match {
-			pathParts[i] = "*"
-			m[i] = wildcard(part)
-		} else if part == "*" {
-			m[i] = part
+		if seg, name := pathSegment(part); name != "" {
+			pathParts[i] = seg
+			m[i] = name
 		}
 	}
 
@@ -68,10 +66,14 @@ func (r *RealtimeDBFunction) Path() string {
 // Implements the CloudEventFunction interface
 type RealtimeDBFunction struct {
 	cloudDeployer
+	DeployOptions[*RealtimeDBFunction]
 	reg           *FunctionRegistrar
 	fn            RealtimeDBFunc
 	data          interface{}
 	pathWildcards map[int]string
+	instance      string                // the name of the database instance, the project ID when empty
+	location      string                // the region of the database instance, defaultRegion when empty
+	chain         []*RealtimeDBFunction // the functions registered before this one on the same trigger
 }
 
 // RealtimeDBFunc is the function signature for firebase Realtime Database Cloud Events
@@ -84,6 +86,43 @@ func (r *RealtimeDBFunction) Ref(ref string) *RealtimeDBFunction {
 	return r
 }
 
+// Instance sets the name of the Realtime Database instance that the function is deployed to, by default the project ID
+// the default instance of newer projects is "{project-id}-default-rtdb"
+// events are dispatched by path, whichever instance they are from
+//
+//	f.RealtimeDB().Instance("my-project-id-default-rtdb").Location("europe-west1").Ref("messages/{pushId}").Write(Message{}, onMessage)
+func (r *RealtimeDBFunction) Instance(name string) *RealtimeDBFunction {
+	r.instance = name
+	return r
+}
+
+// Location sets the region of the Realtime Database instance, by default "us-central1"
+// 2nd gen functions are triggered by Eventarc in the region of the instance: --trigger-location
+func (r *RealtimeDBFunction) Location(region string) *RealtimeDBFunction {
+	r.location = region
+	return r
+}
+
+// InstanceID returns the name of the Realtime Database instance set with Instance, empty for the instance named after the project ID
+func (r *RealtimeDBFunction) InstanceID() string {
+	return r.instance
+}
+
+// LocationID returns the region of the Realtime Database instance: "us-central1"
+func (r *RealtimeDBFunction) LocationID() string {
+	if r.location == "" {
+		return defaultRegion
+	}
+	return r.location
+}
+
+// Named sets the name the function is deployed with, overriding the NamingStrategy of the registrar
+func (r *RealtimeDBFunction) Named(name string) *RealtimeDBFunction {
+	r.name = name
+	r.reg.names = nil
+	return r
+}
+
 // Write registers the specified function to the RefWriteEvent for firebase Realtime Database CloudEvent
 // The provided data is used to populate .Data & .Delta of the RTDBEvent received by the function
 //providers/google.firebase.database/eventTypes/ref.write
@@ -95,10 +134,12 @@ func (r *RealtimeDBFunction) Write(data interface{}, fn RealtimeDBFunc) *Realtim
 		r.reg.realtimeDB[RealtimeDBRefWriteEvent] = make(map[string]*RealtimeDBFunction)
 	}
 
-	r.reg.realtimeDB[RealtimeDBRefWriteEvent][r.Path()] = r
+	key := r.Path()
+	r.chainTo(r.reg.realtimeDB[RealtimeDBRefWriteEvent][key])
+	r.reg.realtimeDB[RealtimeDBRefWriteEvent][key] = r
 
 	r.event = RealtimeDBRefWriteEvent
-	r.reg.events[r.Name()] = r
+	r.reg.addEvent(key, r)
 	return r
 }
 
@@ -113,10 +154,12 @@ func (r *RealtimeDBFunction) Create(data interface{}, fn RealtimeDBFunc) *Realti
 		r.reg.realtimeDB[RealtimeDBRefCreateEvent] = make(map[string]*RealtimeDBFunction)
 	}
 
-	r.reg.realtimeDB[RealtimeDBRefCreateEvent][r.Path()] = r
+	key := r.Path()
+	r.chainTo(r.reg.realtimeDB[RealtimeDBRefCreateEvent][key])
+	r.reg.realtimeDB[RealtimeDBRefCreateEvent][key] = r
 
 	r.event = RealtimeDBRefCreateEvent
-	r.reg.events[r.Name()] = r
+	r.reg.addEvent(key, r)
 	return r
 }
 
@@ -131,10 +174,12 @@ func (r *RealtimeDBFunction) Update(data interface{}, fn RealtimeDBFunc) *Realti
 		r.reg.realtimeDB[RealtimeDBRefUpdateEvent] = make(map[string]*RealtimeDBFunction)
 	}
 
-	r.reg.realtimeDB[RealtimeDBRefUpdateEvent][r.Path()] = r
+	key := r.Path()
+	r.chainTo(r.reg.realtimeDB[RealtimeDBRefUpdateEvent][key])
+	r.reg.realtimeDB[RealtimeDBRefUpdateEvent][key] = r
 
 	r.event = RealtimeDBRefUpdateEvent
-	r.reg.events[r.Name()] = r
+	r.reg.addEvent(key, r)
 	return r
 }
 
@@ -149,13 +194,37 @@ func (r *RealtimeDBFunction) Delete(data interface{}, fn RealtimeDBFunc) *Realti
 		r.reg.realtimeDB[RealtimeDBRefDeleteEvent] = make(map[string]*RealtimeDBFunction)
 	}
 
-	r.reg.realtimeDB[RealtimeDBRefDeleteEvent][r.Path()] = r
+	key := r.Path()
+	r.chainTo(r.reg.realtimeDB[RealtimeDBRefDeleteEvent][key])
+	r.reg.realtimeDB[RealtimeDBRefDeleteEvent][key] = r
 
 	r.event = RealtimeDBRefDeleteEvent
-	r.reg.events[r.Name()] = r
+	r.reg.addEvent(key, r)
 	return r
 }
 
+// chainTo keeps the functions registered before r on the same trigger, they are run before r
+func (r *RealtimeDBFunction) chainTo(prev *RealtimeDBFunction) {
+	if prev == nil || prev == r {
+		return
+	}
+	r.chain = append(prev.chain, prev)
+	prev.chain = nil
+	if r.name == "" {
+		// keep the name set on a function registered before r
+		r.name = prev.name
+	}
+}
+
+// deployOptions returns the options of the function combined with the options of the functions chained before it
+func (r *RealtimeDBFunction) deployOptions() deployOptions {
+	o := deployOptions{}
+	for _, db := range r.chain {
+		o = o.combine(db.options)
+	}
+	return o.combine(r.options)
+}
+
 // RTDBEvent is the expected payload of a firebase Realtime Database CloudEvent
 type RTDBEvent struct {
 	vars  map[string]string
@@ -171,13 +240,29 @@ func (e *RTDBEvent) Vars() map[string]string {
 // CloudEventFunction
 
 // HandleCloudEvent handles the Firebase RealtimeDB CloudEvent and calls the registered RealtimeDBFunction
+// every RealtimeDBFunc registered to the trigger is called in the order they were registered
 func (a *RealtimeDBFunction) HandleCloudEvent(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
-	evt := RTDBEvent{}
-
 	if a == nil {
 		return Debug.Errf("no RealtimeDBFunc registered for [%s]: %s", md.EventType, md.Resource.RawPath)
 	}
 
+	handlers := make([]func() error, 0, len(a.chain)+1)
+	for _, db := range a.chain {
+		db := db
+		handlers = append(handlers, func() error { return db.handle(ctx, md, dec) })
+	}
+	handlers = append(handlers, func() error { return a.handle(ctx, md, dec) })
+	return a.reg.fanOut(handlers)
+}
+
+// handle decodes the event for the data of the function and calls its RealtimeDBFunc
+func (a *RealtimeDBFunction) handle(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	if a.fn == nil {
+		return Debug.Errf("no RealtimeDBFunc registered for [%s]: %s: %w", md.EventType, a.Resource(), ErrNilHandler)
+	}
+
+	evt := RTDBEvent{}
+
 	var reqData struct {
 		Data  json.RawMessage `json:"data"`
 		Delta json.RawMessage `json:"delta"`
@@ -188,7 +273,11 @@ func (a *RealtimeDBFunction) HandleCloudEvent(ctx context.Context, md *metadata.
 		return Debug.Errf("failed to decode realtimeDB event [%s]: %s: %s", md.EventType, err, string(dec.data))
 	}
 
+	// data registered as nil, as is the zero value of an interface T passed by OnRefWrite, is decoded as interface{}
 	dataType := reflect.TypeOf(a.data)
+	if dataType == nil {
+		dataType = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
 	dataT := reflect.New(dataType)
 	deltaT := reflect.New(dataType)
 
@@ -209,14 +298,14 @@ func (a *RealtimeDBFunction) HandleCloudEvent(ctx context.Context, md *metadata.
 
 	err = a.fn(ctx, evt)
 	if err != nil {
-		return Debug.Errf("registered realtimeDBFunc failed [%s]: %s: RealtimeDBFunc %+v", md.EventType, err, a)
+		return Debug.Errf("registered realtimeDBFunc failed [%s]: %w: RealtimeDBFunc %+v", md.EventType, err, a)
 	}
 	return nil
 }
 
-// Name returns the name of the function: "rtdb.ref.{write,create,delete,update}-{path-segments}"
+// Name returns the name of the function: "rtdb-ref-{write,create,delete,update}-{path-segments}", see FunctionRegistrar.WithNaming
 func (a *RealtimeDBFunction) Name() string {
-	return fmt.Sprintf("%s-%s", a.event, normalizeRegexp.ReplaceAllString(a.Resource(), "-$1"))
+	return a.reg.functionName(a)
 }
 
 // Resource returns the resource of the function: "ref/{ref-id}/...."
@@ -2,7 +2,6 @@ package register
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
@@ -14,6 +13,7 @@ const gcsBasePath = "projects/_/buckets/*/objects"
 // Storage returns a new StorageFunction with the FunctionRegistrar set to the parent
 func (f *FunctionRegistrar) Storage() *StorageFunction {
 	s := &StorageFunction{reg: f}
+	s.target = s
 	return s
 }
 
@@ -35,8 +35,10 @@ func (f *FunctionRegistrar) findStorage(event StorageEventType, ref string) *Sto
 // Implements the CloudEventFunction interface
 type StorageFunction struct {
 	cloudDeployer
-	reg *FunctionRegistrar
-	fn  StorageFunc
+	DeployOptions[*StorageFunction]
+	reg   *FunctionRegistrar
+	fn    StorageFunc
+	chain []*StorageFunction // the functions registered before this one on the same trigger
 }
 
 // StorageFunc is the function signature for Google Cloud Storage Cloud Events
@@ -48,6 +50,13 @@ func (s *StorageFunction) Bucket(path string) *StorageFunction {
 	return s
 }
 
+// Named sets the name the function is deployed with, overriding the NamingStrategy of the registrar
+func (s *StorageFunction) Named(name string) *StorageFunction {
+	s.name = name
+	s.reg.names = nil
+	return s
+}
+
 // Finalize registers the specified function to the ObjectFinalizeEvent for Storage CloudEvent
 //google.storage.object.finalize
 func (s *StorageFunction) Finalize(fn StorageFunc) *StorageFunction {
@@ -57,10 +66,11 @@ func (s *StorageFunction) Finalize(fn StorageFunc) *StorageFunction {
 		s.reg.storage[StorageObjectFinalizeEvent] = make(map[string]*StorageFunction)
 	}
 
+	s.chainTo(s.reg.storage[StorageObjectFinalizeEvent][s.resource])
 	s.reg.storage[StorageObjectFinalizeEvent][s.resource] = s
 
 	s.event = StorageObjectFinalizeEvent
-	s.reg.events[s.Name()] = s
+	s.reg.addEvent(s.resource, s)
 	return s
 }
 
@@ -73,10 +83,11 @@ func (s *StorageFunction) Delete(fn StorageFunc) *StorageFunction {
 		s.reg.storage[StorageObjectDeleteEvent] = make(map[string]*StorageFunction)
 	}
 
+	s.chainTo(s.reg.storage[StorageObjectDeleteEvent][s.resource])
 	s.reg.storage[StorageObjectDeleteEvent][s.resource] = s
 
 	s.event = StorageObjectDeleteEvent
-	s.reg.events[s.Name()] = s
+	s.reg.addEvent(s.resource, s)
 	return s
 }
 
@@ -89,10 +100,11 @@ func (s *StorageFunction) Archive(fn StorageFunc) *StorageFunction {
 		s.reg.storage[StorageObjectArchiveEvent] = make(map[string]*StorageFunction)
 	}
 
+	s.chainTo(s.reg.storage[StorageObjectArchiveEvent][s.resource])
 	s.reg.storage[StorageObjectArchiveEvent][s.resource] = s
 
 	s.event = StorageObjectArchiveEvent
-	s.reg.events[s.Name()] = s
+	s.reg.addEvent(s.resource, s)
 	return s
 }
 
@@ -105,13 +117,36 @@ func (s *StorageFunction) MetadataUpdate(fn StorageFunc) *StorageFunction {
 		s.reg.storage[StorageObjectMetadataUpdateEvent] = make(map[string]*StorageFunction)
 	}
 
+	s.chainTo(s.reg.storage[StorageObjectMetadataUpdateEvent][s.resource])
 	s.reg.storage[StorageObjectMetadataUpdateEvent][s.resource] = s
 
 	s.event = StorageObjectMetadataUpdateEvent
-	s.reg.events[s.Name()] = s
+	s.reg.addEvent(s.resource, s)
 	return s
 }
 
+// chainTo keeps the functions registered before s on the same trigger, they are run before s
+func (s *StorageFunction) chainTo(prev *StorageFunction) {
+	if prev == nil || prev == s {
+		return
+	}
+	s.chain = append(prev.chain, prev)
+	prev.chain = nil
+	if s.name == "" {
+		// keep the name set on a function registered before s
+		s.name = prev.name
+	}
+}
+
+// deployOptions returns the options of the function combined with the options of the functions chained before it
+func (s *StorageFunction) deployOptions() deployOptions {
+	o := deployOptions{}
+	for _, st := range s.chain {
+		o = o.combine(st.options)
+	}
+	return o.combine(s.options)
+}
+
 // GCSEvent is the expected payload for Google Cloud Storage CloudEvents.
 /* Finalize:
 {
@@ -222,7 +257,27 @@ type StorageEvent struct {
 // CloudEventFunction
 
 // HandleCloudEvent handles the Google Cloud Storage CloudEvent and calls the registered AuthenticationFunc
+// every StorageFunc registered to the trigger is called in the order they were registered
 func (a *StorageFunction) HandleCloudEvent(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	if a == nil {
+		return Debug.Errf("no StorageFunc registered for [%s]: %s", md.EventType, md.Resource.Name)
+	}
+
+	handlers := make([]func() error, 0, len(a.chain)+1)
+	for _, st := range a.chain {
+		st := st
+		handlers = append(handlers, func() error { return st.handle(ctx, md, dec) })
+	}
+	handlers = append(handlers, func() error { return a.handle(ctx, md, dec) })
+	return a.reg.fanOut(handlers)
+}
+
+// handle decodes the event and calls the StorageFunc of the function
+func (a *StorageFunction) handle(ctx context.Context, md *metadata.Metadata, dec *Decoder) error {
+	if a.fn == nil {
+		return Debug.Errf("no StorageFunc registered for [%s]: %s: %w", md.EventType, a.Resource(), ErrNilHandler)
+	}
+
 	event := StorageEvent{}
 
 	err := dec.Decode(&event)
@@ -232,15 +287,15 @@ func (a *StorageFunction) HandleCloudEvent(ctx context.Context, md *metadata.Met
 
 	err = a.fn(ctx, event)
 	if err != nil {
-		return Debug.Errf("registered realtimeDBFunc failed [%s]: %s: RealtimeDBFunc %+v", md.EventType, err, a)
+		return Debug.Errf("registered storageFunc failed [%s]: %w: StorageFunc %+v", md.EventType, err, a)
 	}
 
 	return nil
 }
 
-// Name returns the name of the function: "storageObject{Archive,Delete,Finalize,Metadata}-{bucketref}"
+// Name returns the name of the function: "storage-object-{archive,delete,finalize,metadata}-{bucket}", see FunctionRegistrar.WithNaming
 func (a *StorageFunction) Name() string {
-	return fmt.Sprintf("%s-%s", a.event, a.Resource())
+	return a.reg.functionName(a)
 }
 
 // Resource returns the resource of the function: "{bucketRef}"
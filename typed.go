@@ -0,0 +1,200 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// TypedFirestoreEvent is a FirestoreEvent with the fields of the document decoded to T
+// Value & OldValue are nil when the document does not exist: OldValue of a create event, Value of a delete event
+// the received values, UpdateMask, Vars & Changed remain available through the embedded FirestoreEvent
+type TypedFirestoreEvent[T any] struct {
+	FirestoreEvent
+	Value    *T
+	OldValue *T
+}
+
+// TypedFirestoreFunc is the function signature for Firestore Cloud Events decoded to T
+type TypedFirestoreFunc[T any] func(ctx context.Context, e TypedFirestoreEvent[T]) error
+
+// OnDocumentCreate registers fn to the DocumentCreateEvent of the document path: "users/{uid}"
+// T must be a struct, the fields are decoded as they are by FirestoreFunction.Create
+//
+//	register.OnDocumentCreate(reg, "users/{uid}", func(ctx context.Context, e register.TypedFirestoreEvent[User]) error {
+//		return welcome(ctx, e.Value.Email)
+//	})
+func OnDocumentCreate[T any](reg *FunctionRegistrar, path string, fn TypedFirestoreFunc[T]) *FirestoreFunction {
+	return typedFirestore(reg, path).Create(new(T), typedFirestoreFunc(fn))
+}
+
+// OnDocumentUpdate registers fn to the DocumentUpdateEvent of the document path: "users/{uid}"
+func OnDocumentUpdate[T any](reg *FunctionRegistrar, path string, fn TypedFirestoreFunc[T]) *FirestoreFunction {
+	return typedFirestore(reg, path).Update(new(T), typedFirestoreFunc(fn))
+}
+
+// OnDocumentDelete registers fn to the DocumentDeleteEvent of the document path: "users/{uid}"
+func OnDocumentDelete[T any](reg *FunctionRegistrar, path string, fn TypedFirestoreFunc[T]) *FirestoreFunction {
+	return typedFirestore(reg, path).Delete(new(T), typedFirestoreFunc(fn))
+}
+
+// OnDocumentWrite registers fn to the DocumentWriteEvent of the document path: "users/{uid}"
+func OnDocumentWrite[T any](reg *FunctionRegistrar, path string, fn TypedFirestoreFunc[T]) *FirestoreFunction {
+	return typedFirestore(reg, path).Write(new(T), typedFirestoreFunc(fn))
+}
+
+// typedFirestore returns a new FirestoreFunction on the given document path
+func typedFirestore(reg *FunctionRegistrar, path string) *FirestoreFunction {
+	f := reg.Firestore()
+	f.resource = strings.Trim(path, "/")
+	return f
+}
+
+// typedFirestoreFunc wraps fn as a FirestoreFunc, the fields are decoded to *T before it is called
+// a nil fn remains nil, so that it is reported by Validate
+func typedFirestoreFunc[T any](fn TypedFirestoreFunc[T]) FirestoreFunc {
+	if fn == nil {
+		return nil
+	}
+	return func(ctx context.Context, e FirestoreEvent) error {
+		evt := TypedFirestoreEvent[T]{FirestoreEvent: e}
+		evt.Value, _ = e.Value.Fields.(*T)
+		evt.OldValue, _ = e.OldValue.Fields.(*T)
+		return fn(ctx, evt)
+	}
+}
+
+// TypedRTDBEvent is a RTDBEvent with the Data & Delta decoded to T
+type TypedRTDBEvent[T any] struct {
+	RTDBEvent
+	Data  *T
+	Delta *T
+}
+
+// TypedRealtimeDBFunc is the function signature for firebase Realtime Database Cloud Events decoded to T
+type TypedRealtimeDBFunc[T any] func(ctx context.Context, e TypedRTDBEvent[T]) error
+
+// OnRefCreate registers fn to the RefCreateEvent of the ref: "users/{uid}"
+// Data & Delta are decoded with encoding/json as they are by RealtimeDBFunction.Create,
+// TypedRTDBEvent[any] receives the maps, slices & values of encoding/json, other interface types fail the event
+func OnRefCreate[T any](reg *FunctionRegistrar, ref string, fn TypedRealtimeDBFunc[T]) *RealtimeDBFunction {
+	return reg.RealtimeDB().Ref(ref).Create(*new(T), typedRealtimeDBFunc(fn))
+}
+
+// OnRefUpdate registers fn to the RefUpdateEvent of the ref: "users/{uid}"
+func OnRefUpdate[T any](reg *FunctionRegistrar, ref string, fn TypedRealtimeDBFunc[T]) *RealtimeDBFunction {
+	return reg.RealtimeDB().Ref(ref).Update(*new(T), typedRealtimeDBFunc(fn))
+}
+
+// OnRefDelete registers fn to the RefDeleteEvent of the ref: "users/{uid}"
+func OnRefDelete[T any](reg *FunctionRegistrar, ref string, fn TypedRealtimeDBFunc[T]) *RealtimeDBFunction {
+	return reg.RealtimeDB().Ref(ref).Delete(*new(T), typedRealtimeDBFunc(fn))
+}
+
+// OnRefWrite registers fn to the RefWriteEvent of the ref: "users/{uid}"
+func OnRefWrite[T any](reg *FunctionRegistrar, ref string, fn TypedRealtimeDBFunc[T]) *RealtimeDBFunction {
+	return reg.RealtimeDB().Ref(ref).Write(*new(T), typedRealtimeDBFunc(fn))
+}
+
+// typedRealtimeDBFunc wraps fn as a RealtimeDBFunc, fails the event when Data & Delta were not decoded to *T:
+// interface types other than interface{} cannot be decoded by encoding/json
+func typedRealtimeDBFunc[T any](fn TypedRealtimeDBFunc[T]) RealtimeDBFunc {
+	if fn == nil {
+		return nil
+	}
+	return func(ctx context.Context, e RTDBEvent) error {
+		evt := TypedRTDBEvent[T]{RTDBEvent: e}
+		var dataOk, deltaOk bool
+		evt.Data, dataOk = e.Data.(*T)
+		evt.Delta, deltaOk = e.Delta.(*T)
+		if !dataOk || !deltaOk {
+			return Debug.Errf("failed to decode realtimeDB event to %T: decoded as %T", evt.Data, e.Data)
+		}
+		return fn(ctx, evt)
+	}
+}
+
+// TypedPubSubMessage is a PubSubMessage with the Data decoded to T
+type TypedPubSubMessage[T any] struct {
+	PubSubMessage
+	Data *T
+}
+
+// TypedPubSubFunc is the function signature for the Pub/Sub CloudEvent decoded to T
+type TypedPubSubFunc[T any] func(ctx context.Context, m TypedPubSubMessage[T]) error
+
+// OnPublish registers fn to the topic, the message is decoded as it is by PubSubFunction.Publish
+func OnPublish[T any](reg *FunctionRegistrar, topic string, fn TypedPubSubFunc[T]) *PubSubFunction {
+	if fn == nil {
+		return reg.PubSub(topic).Publish(*new(T), nil)
+	}
+	return reg.PubSub(topic).Publish(*new(T), func(ctx context.Context, m PubSubMessage) error {
+		msg := TypedPubSubMessage[T]{PubSubMessage: m}
+		switch d := m.Data.(type) {
+		case *T:
+			msg.Data = d
+		case T:
+			// a pointer T is decoded as T, see PubSubMessage
+			msg.Data = &d
+		}
+		return fn(ctx, msg)
+	})
+}
+
+// TypedStorageEvent is a StorageEvent with the custom metadata of the object decoded to T
+// Metadata is nil when the object has no custom metadata
+type TypedStorageEvent[T any] struct {
+	StorageEvent
+	Metadata *T
+}
+
+// TypedStorageFunc is the function signature for Google Cloud Storage Cloud Events with the metadata decoded to T
+type TypedStorageFunc[T any] func(ctx context.Context, e TypedStorageEvent[T]) error
+
+// OnObjectFinalize registers fn to the ObjectFinalizeEvent of the bucket
+// the custom metadata is decoded with encoding/json, the values are always strings:
+//
+//	type Upload struct {
+//		Owner string `json:"owner"`
+//	}
+func OnObjectFinalize[T any](reg *FunctionRegistrar, bucket string, fn TypedStorageFunc[T]) *StorageFunction {
+	return reg.Storage().Bucket(bucket).Finalize(typedStorageFunc(fn))
+}
+
+// OnObjectDelete registers fn to the ObjectDeleteEvent of the bucket
+func OnObjectDelete[T any](reg *FunctionRegistrar, bucket string, fn TypedStorageFunc[T]) *StorageFunction {
+	return reg.Storage().Bucket(bucket).Delete(typedStorageFunc(fn))
+}
+
+// OnObjectArchive registers fn to the ObjectArchiveEvent of the bucket
+func OnObjectArchive[T any](reg *FunctionRegistrar, bucket string, fn TypedStorageFunc[T]) *StorageFunction {
+	return reg.Storage().Bucket(bucket).Archive(typedStorageFunc(fn))
+}
+
+// OnObjectMetadataUpdate registers fn to the ObjectMetadataUpdateEvent of the bucket
+func OnObjectMetadataUpdate[T any](reg *FunctionRegistrar, bucket string, fn TypedStorageFunc[T]) *StorageFunction {
+	return reg.Storage().Bucket(bucket).MetadataUpdate(typedStorageFunc(fn))
+}
+
+// typedStorageFunc wraps fn as a StorageFunc, the metadata is decoded to *T before it is called
+func typedStorageFunc[T any](fn TypedStorageFunc[T]) StorageFunc {
+	if fn == nil {
+		return nil
+	}
+	return func(ctx context.Context, e StorageEvent) error {
+		evt := TypedStorageEvent[T]{StorageEvent: e}
+		if e.Metadata != nil {
+			b, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return Debug.Errf("failed to encode storage metadata: %w", err)
+			}
+
+			evt.Metadata = new(T)
+			err = json.Unmarshal(b, evt.Metadata)
+			if err != nil {
+				return Debug.Errf("failed to decode storage metadata to %T: %w", evt.Metadata, err)
+			}
+		}
+		return fn(ctx, evt)
+	}
+}
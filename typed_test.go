@@ -0,0 +1,177 @@
+package register
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+type TestStorageMeta struct {
+	TTT string `json:"ttt"`
+}
+
+func TestTyped(t *testing.T) {
+	decoder := func(t *testing.T, s string) *Decoder {
+		dec := &Decoder{}
+		err := json.Unmarshal([]byte(s), dec)
+		if err != nil {
+			t.Fatalf("Error unmarshalling test data: %v", err)
+		}
+		return dec
+	}
+	eventContext := func(event string, resource *metadata.Resource) context.Context {
+		return metadata.NewContext(context.Background(), &metadata.Metadata{EventType: event, Resource: resource})
+	}
+
+	t.Run("Firestore", func(t *testing.T) {
+		reg := NewRegister()
+		called := false
+		f := OnDocumentUpdate(reg, "testColl/{uid}", func(ctx context.Context, e TypedFirestoreEvent[TestFirestoreI]) error {
+			called = true
+			if assert.NotNil(t, e.Value, "Value should be decoded") && assert.NotNil(t, e.OldValue, "OldValue should be decoded") {
+				assert.Equal(t, 1234, e.Value.MS.B, "Value.MS.B should be typed")
+				assert.Equal(t, 6544, e.OldValue.MS.B, "OldValue.MS.B should be typed")
+			}
+			assert.Equal(t, "5914E2YLVWcUDHisQwQN", e.Vars()["uid"], "Vars should be available")
+			assert.True(t, e.Changed("MS.B"), "Changed should be available")
+			return nil
+		})
+		assert.Same(t, f, reg.findFirestore(FirestoreDocumentUpdateEvent, "testColl/5914E2YLVWcUDHisQwQN"), "Firestore function should be registered")
+
+		err := reg.EntryPoint(eventContext(string(FirestoreDocumentUpdateEvent), &metadata.Resource{
+			RawPath: "projects/[project-name]/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN",
+		}), decoder(t, testFirestoreUpdate))
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "TypedFirestoreFunc should be called")
+	})
+
+	t.Run("Firestore Delete", func(t *testing.T) {
+		reg := NewRegister()
+		called := false
+		OnDocumentDelete(reg, "/testColl/{uid}/", func(ctx context.Context, e TypedFirestoreEvent[TestFirestoreI]) error {
+			called = true
+			assert.Nil(t, e.Value, "Value should be nil for a deleted document")
+			if assert.NotNil(t, e.OldValue, "OldValue should be decoded") {
+				assert.Equal(t, "asd", e.OldValue.MS.A, "OldValue.MS.A should be typed")
+			}
+			return nil
+		})
+
+		err := reg.EntryPoint(eventContext(string(FirestoreDocumentDeleteEvent), &metadata.Resource{
+			RawPath: "projects/[project-name]/databases/(default)/documents/testColl/5914E2YLVWcUDHisQwQN",
+		}), decoder(t, `{"oldValue": {"fields": {"MS": {"mapValue": {"fields": {"A": {"stringValue": "asd"}}}}}}, "value": {}}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "TypedFirestoreFunc should be called")
+	})
+
+	t.Run("RealtimeDB", func(t *testing.T) {
+		reg := NewRegister()
+		called := false
+		db := OnRefWrite(reg, "testColl/{uid}", func(ctx context.Context, e TypedRTDBEvent[TestRTDBI]) error {
+			called = true
+			if assert.NotNil(t, e.Data, "Data should be decoded") && assert.NotNil(t, e.Delta, "Delta should be decoded") {
+				assert.Equal(t, 112.45, e.Data.NNNNN, "Data.NNNNN should be typed")
+				assert.Equal(t, 112.46545, e.Delta.NNNNN, "Delta.NNNNN should be typed")
+			}
+			assert.Equal(t, "5914E2YLVWcUDHisQwQN", e.Vars()["uid"], "Vars should be available")
+			return nil
+		})
+		assert.Same(t, db, reg.findRealtimeDB(RealtimeDBRefWriteEvent, "testColl/*"), "RealtimeDB function should be registered")
+
+		err := reg.EntryPoint(eventContext(string(RealtimeDBRefWriteEvent), &metadata.Resource{
+			RawPath: "projects/_/instances/[project-id]/refs/testColl/5914E2YLVWcUDHisQwQN",
+		}), decoder(t, `{"data":{"NNNNN":112.45},"delta":{"NNNNN":112.46545}}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "TypedRealtimeDBFunc should be called")
+	})
+
+	t.Run("RealtimeDB Interface", func(t *testing.T) {
+		reg := NewRegister()
+		called := false
+		OnRefWrite(reg, "testColl/{uid}", func(ctx context.Context, e TypedRTDBEvent[any]) error {
+			called = true
+			if assert.NotNil(t, e.Data, "Data should be decoded") {
+				assert.Equal(t, map[string]interface{}{"NNNNN": 112.45}, *e.Data, "Data should be decoded as interface{}")
+			}
+			return nil
+		})
+		OnRefCreate(reg, "testColl/{uid}", func(ctx context.Context, e TypedRTDBEvent[fmt.Stringer]) error {
+			called = true
+			return nil
+		})
+
+		resource := &metadata.Resource{RawPath: "projects/_/instances/[project-id]/refs/testColl/5914E2YLVWcUDHisQwQN"}
+		err := reg.EntryPoint(eventContext(string(RealtimeDBRefWriteEvent), resource), decoder(t, `{"data":{"NNNNN":112.45},"delta":null}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "TypedRealtimeDBFunc should be called")
+
+		called = false
+		assert.NotPanics(t, func() {
+			err = reg.EntryPoint(eventContext(string(RealtimeDBRefCreateEvent), resource), decoder(t, `{"data":{"NNNNN":112.45},"delta":null}`))
+		}, "an interface T should not panic")
+		assert.NotNil(t, err, "Error should not be nil when the data cannot be decoded to the interface")
+		assert.False(t, called, "TypedRealtimeDBFunc should not be called")
+	})
+
+	t.Run("PubSub", func(t *testing.T) {
+		reg := NewRegister()
+		called := false
+		ps := OnPublish(reg, "test-topic", func(ctx context.Context, m TypedPubSubMessage[TestPubSubI]) error {
+			called = true
+			if assert.NotNil(t, m.Data, "Data should be decoded") {
+				assert.Equal(t, "other@email.com", m.Data.Email, "Data.Email should be typed")
+			}
+			assert.Equal(t, "test-topic", m.Topic, "Topic should match")
+			return nil
+		})
+		assert.Same(t, ps, reg.PubSub("test-topic"), "PubSub function should be registered")
+
+		err := reg.EntryPoint(eventContext(string(PubSubPublishEvent), &metadata.Resource{
+			Name: "projects/my-project-id/topics/test-topic",
+		}), decoder(t, fmt.Sprintf(`{"data": "%s"}`, base64.StdEncoding.EncodeToString([]byte(`{"email": "other@email.com"}`)))))
+		assert.Nil(t, err, "Error should be nil")
+		assert.True(t, called, "TypedPubSubFunc should be called")
+
+		var email string
+		OnPublish(reg, "pointer-topic", func(ctx context.Context, m TypedPubSubMessage[*TestPubSubI]) error {
+			if assert.NotNil(t, m.Data, "Data should be decoded") {
+				email = (*m.Data).Email
+			}
+			return nil
+		})
+		err = reg.EntryPoint(eventContext(string(PubSubPublishEvent), &metadata.Resource{
+			Name: "projects/my-project-id/topics/pointer-topic",
+		}), decoder(t, fmt.Sprintf(`{"data": "%s"}`, base64.StdEncoding.EncodeToString([]byte(`{"email": "other@email.com"}`)))))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Equal(t, "other@email.com", email, "pointer types should be decoded")
+	})
+
+	t.Run("Storage", func(t *testing.T) {
+		reg := NewRegister()
+		var meta *TestStorageMeta
+		st := OnObjectMetadataUpdate(reg, "testBucket", func(ctx context.Context, e TypedStorageEvent[TestStorageMeta]) error {
+			meta = e.Metadata
+			assert.Equal(t, "1 S Morrison.pdf", e.Name, "Name should be available")
+			return nil
+		})
+		assert.Same(t, st, reg.storage[StorageObjectMetadataUpdateEvent]["testBucket"], "Storage function should be registered")
+
+		md := eventContext(string(StorageObjectMetadataUpdateEvent), &metadata.Resource{
+			Name: "projects/_/buckets/testBucket/objects/profile/image.jpg",
+		})
+		err := reg.EntryPoint(md, decoder(t, `{"name": "1 S Morrison.pdf", "metadata": {"ttt": "123"}}`))
+		assert.Nil(t, err, "Error should be nil")
+		if assert.NotNil(t, meta, "Metadata should be decoded") {
+			assert.Equal(t, "123", meta.TTT, "Metadata.TTT should be typed")
+		}
+
+		err = reg.EntryPoint(md, decoder(t, `{"name": "1 S Morrison.pdf"}`))
+		assert.Nil(t, err, "Error should be nil")
+		assert.Nil(t, meta, "Metadata should be nil when the object has none")
+	})
+}
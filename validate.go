@@ -0,0 +1,323 @@
+package register
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxNameLength is the maximum length of a Cloud Functions name
+const maxNameLength = 63
+
+var (
+	// ErrDuplicateName is returned for functions that are replaced by a later function registered to the same trigger,
+	// or are deployed with the same name as another function
+	ErrDuplicateName = errors.New("duplicate function name")
+	// ErrOverlappingRoute is returned for Firestore paths & RealtimeDB refs of the same event that can both match a path,
+	// without one being more specific than the other, or that differ only by their wildcards: "users/{uid}" & "users/*"
+	ErrOverlappingRoute = errors.New("overlapping route")
+	// ErrNilHandler is returned for functions registered with a nil handler
+	ErrNilHandler = errors.New("nil handler")
+	// ErrRecursiveWildcard is returned for Firestore paths & RealtimeDB refs with a recursive wildcard: "users/{document=**}",
+	// which can only be deployed as 2nd gen functions, see FunctionRegistrar.Gen2
+	ErrRecursiveWildcard = errors.New("recursive wildcards require 2nd gen functions")
+	// ErrPathParity is returned for Firestore paths that do not end on a document: "users" instead of "users/{uid}"
+	ErrPathParity = errors.New("firestore path must have an even number of segments")
+	// ErrNameTooLong is returned for function names over the 63 character limit of Cloud Functions
+	ErrNameTooLong = errors.New("function name exceeds 63 characters")
+	// ErrInvalidName is returned for function names that do not start with a letter, end with a letter or digit,
+	// contain characters other than letters, digits, hyphens & underscores, or contain upper case letters for 2nd gen functions
+	ErrInvalidName = errors.New("invalid function name")
+)
+
+// RegistrationError describes a single registered function that failed validation
+type RegistrationError struct {
+	Name     string    // the generated name of the function, the path of HTTP functions
+	Event    EventType // the event the function is registered to, empty for HTTP functions
+	Resource string    // the resource of the function: "users/{uid}"
+	Err      error
+}
+
+func (e *RegistrationError) Error() string {
+	if e.Event == "" {
+		return fmt.Sprintf("%s: %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", e.Name, e.Event, e.Resource, e.Err)
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by Validate when one or more registered functions are invalid
+// errors.Is can be used to check for ErrDuplicateName, ErrOverlappingRoute, ErrNilHandler, ErrRecursiveWildcard, ErrPathParity, ErrNameTooLong & ErrInvalidName
+type ValidationError struct {
+	Errors []*RegistrationError
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Errors))
+	for i, re := range e.Errors {
+		s[i] = re.Error()
+	}
+	return fmt.Sprintf("%d invalid registration(s): %s", len(e.Errors), strings.Join(s, "; "))
+}
+
+// Is reports whether any of the registration errors matches the target
+func (e *ValidationError) Is(target error) bool {
+	for _, re := range e.Errors {
+		if errors.Is(re, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the registered functions before they are deployed, returns *ValidationError listing:
+//   - functions replaced by a later function, handlers of the same trigger are not duplicates, and functions with the same name
+//   - Firestore paths & RealtimeDB refs of the same event that overlap: "users/{uid}/posts/new" & "users/admin/posts/{pid}",
+//     or that collapse to the same trigger: "users/{uid}" & "users/*"
+//   - functions & HTTP handlers registered with a nil handler, including PubSub branches registered with When & WhenFunc
+//   - Firestore paths & RealtimeDB refs with a recursive wildcard, unless deployed as 2nd gen functions
+//   - Firestore paths that do not end on a document, unless they end with a recursive wildcard
+//   - names over the 63 character limit of Cloud Functions, or with characters Cloud Functions rejects
+//
+// Deploy refuses to output a script while Validate returns an error
+func (f *FunctionRegistrar) Validate() error {
+	errs := []*RegistrationError{}
+	names := f.functionNames()
+	fail := func(fn CloudDeployFunction, err error) {
+		d := fn.(registeredFunction).deployer()
+		name := d.name
+		if name == "" {
+			name = names[d.key]
+		}
+		errs = append(errs, &RegistrationError{Name: name, Event: fn.Event(), Resource: fn.Resource(), Err: err})
+	}
+
+	// functions that remain registered: each function in events and the functions chained before it
+	deployed := make(map[CloudDeployFunction]bool, len(f.registered))
+	for _, fn := range f.events {
+		for _, h := range handlersOf(fn) {
+			deployed[h] = true
+		}
+	}
+
+	for _, fn := range f.registered {
+		if !deployed[fn] {
+			fail(fn, ErrDuplicateName)
+			continue
+		}
+		if !hasHandler(fn) {
+			fail(fn, ErrNilHandler)
+		}
+		if ps, ok := fn.(*PubSubFunction); ok {
+			// a message matched by a branch is never handled by the default handler
+			for i, b := range ps.branches {
+				if b.fn == nil {
+					fail(fn, fmt.Errorf("%w: When branch %d", ErrNilHandler, i))
+				}
+			}
+		}
+
+		// different paths normalized to the same trigger are chained into one function
+		first := handlersOf(f.events[fn.deployer().key])[0]
+		if first.Resource() != fn.Resource() {
+			fail(fn, fmt.Errorf("%w: %s collapses with %s", ErrOverlappingRoute, fn.Resource(), first.Resource()))
+		}
+	}
+
+	// the handlers of the same trigger are deployed as one function
+	evs := f.deployEvents()
+	for i, de := range evs {
+		ev, name := de.fn, de.name
+		if i > 0 && evs[i-1].name == name {
+			fail(ev, ErrDuplicateName)
+		}
+		if !f.gen2 && recursiveRoute(ev) {
+			fail(ev, ErrRecursiveWildcard)
+		}
+		if fs, ok := ev.(*FirestoreFunction); ok && !validFirestorePath(fs.Resource()) {
+			fail(ev, ErrPathParity)
+		}
+		if len(name) > maxNameLength {
+			fail(ev, ErrNameTooLong)
+		}
+		if !nameRegexp.MatchString(name) || (f.gen2 && !AuthEventType(ev.Event()).Valid() && name != strings.ToLower(name)) {
+			fail(ev, ErrInvalidName)
+		}
+
+		for _, other := range evs[i+1:] {
+			if overlaps(ev, other.fn) {
+				fail(ev, fmt.Errorf("%w with %s", ErrOverlappingRoute, other.name))
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(f.handlers))
+	for p := range f.handlers {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if f.handlers[p].fn == nil {
+			errs = append(errs, &RegistrationError{Name: p, Resource: p, Err: ErrNilHandler})
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// handlersOf returns the function and the functions chained before it on the same trigger
+func handlersOf(fn CloudDeployFunction) []CloudDeployFunction {
+	fns := []CloudDeployFunction{}
+	switch v := fn.(type) {
+	case *FirestoreFunction:
+		for _, c := range v.chain {
+			fns = append(fns, c)
+		}
+	case *RealtimeDBFunction:
+		for _, c := range v.chain {
+			fns = append(fns, c)
+		}
+	case *StorageFunction:
+		for _, c := range v.chain {
+			fns = append(fns, c)
+		}
+	}
+	return append(fns, fn)
+}
+
+// hasHandler reports whether the function was registered with a non-nil handler
+func hasHandler(fn CloudDeployFunction) bool {
+	switch v := fn.(type) {
+	case *FirestoreFunction:
+		return v.fn != nil
+	case *RealtimeDBFunction:
+		return v.fn != nil
+	case *StorageFunction:
+		return v.fn != nil
+	case *PubSubFunction:
+		// the default handler is optional when branches are registered, the branches are checked by Validate
+		return v.fn != nil || len(v.branches) > 0
+	case *AuthenticationFunction:
+		return v.fn != nil
+	}
+	return true
+}
+
+// recursiveRoute reports whether the Firestore path or RealtimeDB ref of the function ends with a recursive wildcard
+// 1st gen --trigger-resource only accepts single segment wildcards, 2nd gen path patterns accept both
+func recursiveRoute(fn CloudDeployFunction) bool {
+	switch v := fn.(type) {
+	case *FirestoreFunction:
+		return isRecursivePath(strings.Split(v.Path(), "/"))
+	case *RealtimeDBFunction:
+		return isRecursivePath(strings.Split(v.Path(), "/"))
+	}
+	return false
+}
+
+// validFirestorePath reports whether the resource ends on a document: "users/{uid}"
+// paths ending with a recursive wildcard match documents at any depth: "users/{document=**}"
+func validFirestorePath(resource string) bool {
+	segs := strings.Split(resource, "/")
+	for _, s := range segs {
+		if s == "" {
+			return false
+		}
+	}
+	if seg, _ := pathSegment(segs[len(segs)-1]); seg == recursiveWildcard {
+		return true
+	}
+	return len(segs)%2 == 0
+}
+
+// overlaps reports whether the routes of two functions registered to the same event can both match a path
+// without one being more specific than the other, a more specific route always takes precedence:
+// "users/admin" & "users/{uid}" do not overlap, "users/admin/posts/{pid}" & "users/{uid}/posts/new" do
+func overlaps(a, b CloudDeployFunction) bool {
+	if a.Event() != b.Event() {
+		return false
+	}
+
+	var pa, pb string
+	switch x := a.(type) {
+	case *FirestoreFunction:
+		y, ok := b.(*FirestoreFunction)
+		if !ok || x.DatabaseID() != y.DatabaseID() {
+			return false
+		}
+		pa, pb = x.Path(), y.Path()
+	case *RealtimeDBFunction:
+		y, ok := b.(*RealtimeDBFunction)
+		if !ok {
+			return false
+		}
+		pa, pb = x.Path(), y.Path()
+	default:
+		return false
+	}
+
+	sa, sb := strings.Split(pa, "/"), strings.Split(pb, "/")
+	return intersects(sa, sb) && !covers(sa, sb) && !covers(sb, sa)
+}
+
+// intersects reports whether a path can match the segments of both registered paths
+func intersects(a, b []string) bool {
+	ra, rb := isRecursivePath(a), isRecursivePath(b)
+	if ra {
+		a = a[:len(a)-1]
+	}
+	if rb {
+		b = b[:len(b)-1]
+	}
+
+	switch {
+	case !ra && !rb && len(a) != len(b):
+		return false
+	case ra && !rb && len(b) <= len(a):
+		return false
+	case rb && !ra && len(a) <= len(b):
+		return false
+	}
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] && segmentRank(a[i]) == 0 && segmentRank(b[i]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// covers reports whether every path matched by the segments of b is matched by a
+func covers(a, b []string) bool {
+	ra, rb := isRecursivePath(a), isRecursivePath(b)
+	if ra {
+		a = a[:len(a)-1]
+	}
+	if rb {
+		b = b[:len(b)-1]
+	}
+
+	switch {
+	case !ra && (rb || len(a) != len(b)):
+		return false
+	case ra && len(b) < len(a):
+		return false
+	case ra && !rb && len(b) == len(a):
+		// a trailing ** matches at least one segment
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] && a[i] != "*" {
+			return false
+		}
+	}
+	return true
+}
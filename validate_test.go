@@ -0,0 +1,269 @@
+package register
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	noopFirestore := func(ctx context.Context, e FirestoreEvent) error { return nil }
+	noopRTDB := func(ctx context.Context, e RTDBEvent) error { return nil }
+	noopAuth := func(ctx context.Context, e AuthEvent) error { return nil }
+
+	// invalid returns the registration errors, failing the test unless err is a *ValidationError
+	invalid := func(t *testing.T, err error) []*RegistrationError {
+		var ve *ValidationError
+		if !assert.True(t, errors.As(err, &ve), "Error should be *ValidationError: %v", err) {
+			return nil
+		}
+		return ve.Errors
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("admin").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Update(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Database("analytics").Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.RealtimeDB().Ref("users/{uid}").Write(TestRTDBI{}, noopRTDB)
+		reg.Authentication().Create(noopAuth)
+		reg.HTTP("/users", func(w http.ResponseWriter, r *http.Request) {})
+
+		assert.Nil(t, reg.Validate(), "Error should be nil")
+		assert.NotEmpty(t, reg.Deploy(), "Deploy should output the script")
+	})
+
+	t.Run("Duplicate Name", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Authentication().Create(noopAuth)
+		reg.Authentication().Create(noopAuth)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 1, "Errors should contain the replaced function") {
+			assert.True(t, errors.Is(errs[0], ErrDuplicateName), "Error should be ErrDuplicateName: %s", errs[0])
+			assert.Equal(t, "auth-user-create", errs[0].Name, "Name should match")
+		}
+	})
+
+	t.Run("Overlapping Route", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("admin").Collection("posts").Document("{pid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Collection("posts").Document("new").Create(TestFirestoreI{}, noopFirestore)
+		// different events & databases do not overlap
+		reg.Firestore().Collection("users").Document("{uid}").Collection("posts").Document("new").Update(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Database("analytics").Collection("users").Document("{uid}").Collection("posts").Document("new").Create(TestFirestoreI{}, noopFirestore)
+		reg.RealtimeDB().Ref("users/{uid}/name").Write(TestRTDBI{}, noopRTDB)
+		reg.RealtimeDB().Ref("users/admin/{field}").Write(TestRTDBI{}, noopRTDB)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 2, "Errors should contain both overlapping routes") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrOverlappingRoute), "Error should be ErrOverlappingRoute: %s", err)
+			}
+			assert.Equal(t, FirestoreDocumentCreateEvent.Type(), errs[0].Event, "Event should match")
+			assert.Equal(t, RealtimeDBRefWriteEvent.Type(), errs[1].Event, "Event should match")
+		}
+	})
+
+	t.Run("Collapsed Paths", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("*").Create(TestFirestoreI{}, noopFirestore)
+		reg.RealtimeDB().Ref("users/{uid}").Write(TestRTDBI{}, noopRTDB)
+		reg.RealtimeDB().Ref("users/{id}").Write(TestRTDBI{}, noopRTDB)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 2, "Errors should contain the paths collapsed onto an earlier path") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrOverlappingRoute), "Error should be ErrOverlappingRoute: %s", err)
+			}
+			assert.Equal(t, "users/*", errs[0].Resource, "Resource should be the later path")
+			assert.Equal(t, "users/{id}", errs[1].Resource, "Resource should be the later path")
+		}
+	})
+
+	t.Run("Recursive Overlap", func(t *testing.T) {
+		assert.True(t, intersects(strings.Split("users/*/**", "/"), strings.Split("*/admin/**", "/")), "recursive paths should intersect")
+		assert.True(t, intersects(strings.Split("users/**", "/"), strings.Split("users/*/posts/*", "/")), "recursive path should intersect a longer path")
+		assert.False(t, intersects(strings.Split("users/*/**", "/"), strings.Split("users/*", "/")), "** should match at least one segment")
+		assert.True(t, covers(strings.Split("users/**", "/"), strings.Split("users/*/posts/*", "/")), "recursive path should cover a longer path")
+		assert.True(t, covers(strings.Split("users/**", "/"), strings.Split("users/admin/**", "/")), "recursive path should cover a longer recursive path")
+		assert.False(t, covers(strings.Split("users/*/**", "/"), strings.Split("users/**", "/")), "recursive path should not cover a shorter recursive path")
+
+		reg := NewRegister().Gen2(true)
+		reg.Firestore().Collection("users").Document("{uid}").Collection("posts").Document("{document=**}").Write(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("{coll}").Document("admin").Collection("{sub}").Document("{document=**}").Write(TestFirestoreI{}, noopFirestore)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 1, "Errors should contain the overlapping route") {
+			assert.True(t, errors.Is(errs[0], ErrOverlappingRoute), "Error should be ErrOverlappingRoute: %s", errs[0])
+		}
+	})
+
+	t.Run("Nil Handler", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, nil)
+		reg.PubSub("topic")
+		OnRefCreate[TestRTDBI](reg, "users/{uid}", nil)
+		reg.HTTP("/users", nil)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 4, "Errors should contain each nil handler") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrNilHandler), "Error should be ErrNilHandler: %s", err)
+			}
+			assert.Equal(t, "/users", errs[3].Name, "Name should be the path of the HTTP function")
+		}
+	})
+
+	t.Run("Nil Branch", func(t *testing.T) {
+		noopPubSub := func(ctx context.Context, m PubSubMessage) error { return nil }
+		reg := NewRegister()
+		reg.PubSub("orders").
+			When("event_type", "created").Publish(TestPubSubI{}, noopPubSub).
+			When("event_type", "cancelled").Publish(TestPubSubI{}, nil).
+			Publish(TestPubSubI{}, noopPubSub)
+		reg.PubSub("audit").WhenFunc(func(m PubSubMessage) bool { return true })
+		// branches without a default handler skip the messages none of them match
+		reg.PubSub("events").When("event_type", "created").Publish(nil, noopPubSub)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 2, "Errors should contain each nil branch") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrNilHandler), "Error should be ErrNilHandler: %s", err)
+			}
+			assert.Equal(t, "orders", errs[0].Resource, "Resource should be the topic")
+			assert.Contains(t, errs[0].Error(), "When branch 1", "Error should name the branch")
+			assert.Equal(t, "audit", errs[1].Resource, "Resource should be the topic")
+		}
+	})
+
+	t.Run("Nil Handler Dispatch", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, nil)
+		reg.RealtimeDB().Ref("users/{uid}").Write(TestRTDBI{}, nil)
+		reg.Storage().Bucket("uploads").Finalize(nil)
+		reg.Authentication().Create(nil)
+		reg.PubSub("orders").When("event_type", "created").Publish(nil, nil)
+		reg.PubSub("audit")
+
+		events := map[string]*metadata.Metadata{
+			"Firestore":      {EventType: string(FirestoreDocumentCreateEvent), Resource: &metadata.Resource{RawPath: "projects/p/databases/(default)/documents/users/1"}},
+			"RealtimeDB":     {EventType: string(RealtimeDBRefWriteEvent), Resource: &metadata.Resource{RawPath: "projects/_/instances/p/refs/users/1"}},
+			"Storage":        {EventType: string(StorageObjectFinalizeEvent), Resource: &metadata.Resource{Name: "projects/_/buckets/uploads/objects/a.txt"}},
+			"Authentication": {EventType: string(AuthenticationUserCreateEvent), Resource: &metadata.Resource{}},
+			"PubSub Branch":  {EventType: string(PubSubPublishEvent), Resource: &metadata.Resource{Name: "projects/p/topics/orders"}},
+			"PubSub":         {EventType: string(PubSubPublishEvent), Resource: &metadata.Resource{Name: "projects/p/topics/audit"}},
+		}
+		for name, md := range events {
+			md := md
+			t.Run(name, func(t *testing.T) {
+				dec := &Decoder{}
+				if err := json.Unmarshal([]byte(`{"attributes": {"event_type": "created"}}`), dec); err != nil {
+					t.Fatalf("Error unmarshalling test data: %v", err)
+				}
+
+				var err error
+				assert.NotPanics(t, func() {
+					err = reg.EntryPoint(metadata.NewContext(context.Background(), md), dec)
+				}, "a nil handler should not panic")
+				assert.True(t, errors.Is(err, ErrNilHandler), "Error should be ErrNilHandler: %v", err)
+			})
+		}
+
+		// messages no branch matches are skipped when the topic has no default handler
+		dec := &Decoder{}
+		if err := json.Unmarshal([]byte(`{"attributes": {"event_type": "cancelled"}}`), dec); err != nil {
+			t.Fatalf("Error unmarshalling test data: %v", err)
+		}
+		err := reg.EntryPoint(metadata.NewContext(context.Background(), events["PubSub Branch"]), dec)
+		assert.Nil(t, err, "Error should be nil for an unmatched message")
+	})
+
+	t.Run("Recursive Wildcard", func(t *testing.T) {
+		reg := NewRegister().WithProjectID("my-project-id")
+		reg.Firestore().Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{document=**}").Delete(TestFirestoreI{}, noopFirestore)
+		reg.RealtimeDB().Ref("users/**").Write(TestRTDBI{}, noopRTDB)
+
+		_, err := reg.DeployE()
+		errs := invalid(t, err)
+		if assert.Len(t, errs, 2, "Errors should contain the recursive routes") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrRecursiveWildcard), "Error should be ErrRecursiveWildcard: %s", err)
+			}
+			assert.Equal(t, "users/{document=**}", errs[0].Resource, "Resource should match")
+			assert.Equal(t, "users/**", errs[1].Resource, "Resource should match")
+		}
+
+		script, err := reg.Gen2(true).DeployE()
+		assert.Nil(t, err, "Error should be nil for 2nd gen functions")
+		assert.Contains(t, script, `--trigger-event-filters-path-pattern "document=users/{document=**}"`, "2nd gen should deploy the recursive path pattern")
+		assert.Contains(t, script, `--trigger-event-filters-path-pattern "ref=users/**"`, "2nd gen should deploy the recursive ref pattern")
+	})
+
+	t.Run("Path Parity", func(t *testing.T) {
+		reg := NewRegister().Gen2(true)
+		reg.Firestore().Collection("users").Create(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Collection("posts").Update(TestFirestoreI{}, noopFirestore)
+		reg.Firestore().Collection("users").Document("{uid}").Collection("{document=**}").Delete(TestFirestoreI{}, noopFirestore)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 2, "Errors should contain the collection paths") {
+			for _, err := range errs {
+				assert.True(t, errors.Is(err, ErrPathParity), "Error should be ErrPathParity: %s", err)
+			}
+			assert.Equal(t, "users", errs[0].Resource, "Resource should match")
+			assert.Equal(t, "users/{uid}/posts", errs[1].Resource, "Resource should match")
+		}
+	})
+
+	t.Run("Name Too Long", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Named(strings.Repeat("a", maxNameLength+1)).Collection("users").Document("{uid}").Create(TestFirestoreI{}, noopFirestore)
+
+		errs := invalid(t, reg.Validate())
+		if assert.Len(t, errs, 1, "Errors should contain the function") {
+			assert.True(t, errors.Is(errs[0], ErrNameTooLong), "Error should be ErrNameTooLong: %s", errs[0])
+		}
+	})
+
+	t.Run("Deploy", func(t *testing.T) {
+		reg := NewRegister()
+		reg.Firestore().Collection("users").Create(TestFirestoreI{}, nil)
+		reg.Authentication().Named("it's").Create(noopAuth)
+
+		s, err := reg.DeployE()
+		assert.Equal(t, "", s, "DeployE should refuse to output a script")
+		errs := invalid(t, err)
+		assert.Len(t, errs, 3, "Errors should contain each invalid registration")
+
+		script := reg.Deploy()
+		assert.True(t, strings.HasPrefix(script, "echo 'refusing to deploy: 3 invalid registration(s): "), "script should print the errors: %s", script)
+		assert.True(t, strings.HasSuffix(script, ">&2; exit 1"), "script should fail: %s", script)
+		assert.NotContains(t, script, "gcloud", "script should not deploy")
+		assert.NotEmpty(t, reg.DeployCloud(), "DeployCloud should not validate")
+
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("bash is not available")
+		}
+		var stderr strings.Builder
+		cmd := exec.Command("bash", "-c", script)
+		cmd.Stderr = &stderr
+		var exit *exec.ExitError
+		if assert.True(t, errors.As(cmd.Run(), &exit), "script should exit with an error") {
+			assert.Equal(t, 1, exit.ExitCode(), "script should exit with status 1")
+		}
+		assert.Equal(t, "refusing to deploy: "+err.Error()+"\n", stderr.String(), "stderr should contain the quoted errors")
+	})
+}